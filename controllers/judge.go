@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"kiit-lab-engine/db"
+	"kiit-lab-engine/middleware"
+	"kiit-lab-engine/repository"
+	"kiit-lab-engine/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JudgeController struct {
+	judgeService service.JudgeService
+}
+
+func NewJudgeController(judgeService service.JudgeService) *JudgeController {
+	return &JudgeController{judgeService: judgeService}
+}
+
+func (j *JudgeController) Submit(c *gin.Context) {
+	var input service.SubmitJudgeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.UserID = middleware.UserID(c)
+
+	job, err := j.judgeService.Submit(c.Request.Context(), input)
+	if err != nil {
+		c.JSON(judgeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": job.ID, "status": job.Status})
+}
+
+func (j *JudgeController) Run(c *gin.Context) {
+	var input service.SubmitJudgeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The run is killed if the client goes away
+	result, err := j.judgeService.Run(c.Request.Context(), input)
+	if err != nil {
+		c.JSON(judgeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (j *JudgeController) GetStatus(c *gin.Context) {
+	id := c.Param("id")
+
+	job, err := j.judgeService.GetJob(c.Request.Context(), id, middleware.UserID(c))
+	if err != nil {
+		c.JSON(judgeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": job.ID, "status": job.Status})
+}
+
+func (j *JudgeController) GetResult(c *gin.Context) {
+	id := c.Param("id")
+
+	job, err := j.judgeService.GetJob(c.Request.Context(), id, middleware.UserID(c))
+	if err != nil {
+		c.JSON(judgeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if job.Status != db.JudgeJobStatusDone {
+		c.JSON(http.StatusConflict, gin.H{"error": "judge job is not done", "status": job.Status})
+		return
+	}
+
+	if jobErr, ok := job.Error(); ok {
+		c.JSON(http.StatusOK, gin.H{"id": job.ID, "status": job.Status, "error": jobErr})
+		return
+	}
+
+	result, _ := job.Result()
+	c.JSON(http.StatusOK, gin.H{"id": job.ID, "status": job.Status, "result": result})
+}
+
+func (j *JudgeController) Ready(c *gin.Context) {
+	readiness := j.judgeService.Readiness()
+	if !readiness.Ready {
+		c.JSON(http.StatusServiceUnavailable, readiness)
+		return
+	}
+
+	c.JSON(http.StatusOK, readiness)
+}
+
+func (j *JudgeController) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, j.judgeService.Stats())
+}
+
+// judgeErrorStatus returns the HTTP status of an error of the judge service: a client error for requests that cannot be judged as sent
+// or refer to something that does not exist, a server error otherwise.
+func judgeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidSubmission):
+		return http.StatusBadRequest
+	case errors.Is(err, repository.ErrQuestionNotFound), errors.Is(err, repository.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrJudgeNotReady):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
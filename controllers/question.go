@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"kiit-lab-engine/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QuestionController struct {
+	questionService service.QuestionService
+}
+
+func NewQuestionController(questionService service.QuestionService) *QuestionController {
+	return &QuestionController{questionService: questionService}
+}
+
+func (q *QuestionController) CreateQuestion(c *gin.Context) {
+	var input service.CreateQuestionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	question, err := q.questionService.CreateQuestion(c.Request.Context(), input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, question)
+}
+
+func (q *QuestionController) GetQuestion(c *gin.Context) {
+	id := c.Param("id")
+
+	question, err := q.questionService.GetQuestion(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, question)
+}
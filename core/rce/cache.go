@@ -0,0 +1,310 @@
+package rce
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArtifactCache keeps the working directory of successful compilations on disk so identical submissions skip the compiler.
+// Entries are keyed by language, toolchain version, compile command and the hash of every file, and the least recently used
+// entries are evicted once the cache grows past its size.
+type ArtifactCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Elements hold *cacheEntry, most recently used at the front
+	lru     *list.List
+	stats   ArtifactCacheStats
+}
+
+// ArtifactCacheStats is a snapshot of the use of an ArtifactCache.
+type ArtifactCacheStats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"maxBytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// cacheEntry is an artifact stored in the cache directory as <key>.tar with its compile result in <key>.json.
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+var (
+	defaultArtifactCache   *ArtifactCache
+	defaultArtifactCacheMu sync.RWMutex
+)
+
+// NewArtifactCache opens the cache in the directory, creating it if needed, bounded to maxBytes on disk.
+// Entries left by a previous run are kept, ordered by their last use.
+func NewArtifactCache(dir string, maxBytes int64) (*ArtifactCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create artifact cache: %w", err)
+	}
+
+	c := &ArtifactCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+	c.stats.MaxBytes = maxBytes
+
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("failed to load artifact cache: %w", err)
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// SetDefaultArtifactCache sets the cache the runners use, nil disables caching.
+func SetDefaultArtifactCache(cache *ArtifactCache) {
+	defaultArtifactCacheMu.Lock()
+	defer defaultArtifactCacheMu.Unlock()
+	defaultArtifactCache = cache
+}
+
+// DefaultArtifactCache returns the cache the runners use, or nil when caching is disabled.
+func DefaultArtifactCache() *ArtifactCache {
+	defaultArtifactCacheMu.RLock()
+	defer defaultArtifactCacheMu.RUnlock()
+	return defaultArtifactCache
+}
+
+// Get returns the compile result and the working directory archive stored under the key.
+func (c *ArtifactCache) Get(key string) (CompileResult, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return CompileResult{}, nil, false
+	}
+
+	compile, snapshot, err := c.read(key)
+	if err != nil {
+		log.Printf("Failed to read cached artifact: %v", err)
+		c.remove(element)
+		c.stats.Misses++
+		return CompileResult{}, nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	now := time.Now()
+	os.Chtimes(c.path(key, ".tar"), now, now) // Keeps the order of use across restarts
+	c.stats.Hits++
+
+	compile.Cached = true
+	return compile, snapshot, true
+}
+
+// Put stores the compile result and the working directory archive under the key, evicting the least recently used entries to make room.
+func (c *ArtifactCache) Put(key string, compile CompileResult, snapshot []byte) error {
+	meta, err := json.Marshal(compile)
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(snapshot) + len(meta))
+	if size > c.maxBytes {
+		return nil // Would evict everything else and still not fit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return nil
+	}
+
+	// The archive is written last so a crash never leaves an archive without its compile result
+	if err := writeFileAtomic(c.path(key, ".json"), meta); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path(key, ".tar"), snapshot); err != nil {
+		os.Remove(c.path(key, ".json"))
+		return err
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	c.stats.Entries++
+	c.stats.Bytes += size
+	c.evict()
+
+	return nil
+}
+
+// Stats returns the current use of the cache.
+func (c *ArtifactCache) Stats() ArtifactCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// load indexes the entries in the cache directory, most recently used first.
+func (c *ArtifactCache) load() error {
+	archives, err := filepath.Glob(filepath.Join(c.dir, "*.tar"))
+	if err != nil {
+		return err
+	}
+
+	type stored struct {
+		entry  *cacheEntry
+		usedAt time.Time
+	}
+	var found []stored
+	for _, archive := range archives {
+		key := strings.TrimSuffix(filepath.Base(archive), ".tar")
+		archiveInfo, err := os.Stat(archive)
+		if err != nil {
+			continue
+		}
+		metaInfo, err := os.Stat(c.path(key, ".json"))
+		if err != nil {
+			os.Remove(archive) // Incomplete entry
+			continue
+		}
+		found = append(found, stored{
+			entry:  &cacheEntry{key: key, size: archiveInfo.Size() + metaInfo.Size()},
+			usedAt: archiveInfo.ModTime(),
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].usedAt.After(found[j].usedAt) })
+	for _, s := range found {
+		c.entries[s.entry.key] = c.lru.PushBack(s.entry)
+		c.stats.Entries++
+		c.stats.Bytes += s.entry.size
+	}
+	return nil
+}
+
+// read returns the compile result and the archive stored under the key.
+func (c *ArtifactCache) read(key string) (CompileResult, []byte, error) {
+	meta, err := os.ReadFile(c.path(key, ".json"))
+	if err != nil {
+		return CompileResult{}, nil, err
+	}
+	var compile CompileResult
+	if err := json.Unmarshal(meta, &compile); err != nil {
+		return CompileResult{}, nil, err
+	}
+
+	snapshot, err := os.ReadFile(c.path(key, ".tar"))
+	if err != nil {
+		return CompileResult{}, nil, err
+	}
+	return compile, snapshot, nil
+}
+
+// evict removes the least recently used entries until the cache fits in its size. The caller holds the lock.
+func (c *ArtifactCache) evict() {
+	for c.stats.Bytes > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.remove(oldest)
+		c.stats.Evictions++
+	}
+}
+
+// remove deletes the entry of the element from the index and the disk. The caller holds the lock.
+func (c *ArtifactCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.stats.Entries--
+	c.stats.Bytes -= entry.size
+
+	os.Remove(c.path(entry.key, ".tar"))
+	os.Remove(c.path(entry.key, ".json"))
+}
+
+// path returns the path of the file with the extension of the entry with the key.
+func (c *ArtifactCache) path(key string, ext string) string {
+	return filepath.Join(c.dir, key+ext)
+}
+
+// writeFileAtomic writes the file through a temporary file so readers never see it half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lookupArtifact returns the cache key of compiling the files for the language and the cached compilation, if any.
+// The toolchain version is only asked for when the cache is used. The key is empty when caching is disabled, the language has nothing
+// to compile or its toolchain version is unknown.
+func lookupArtifact(spec LanguageSpec, files []File, toolchain func() (string, error)) (string, CompileResult, []byte, bool, error) {
+	cache := DefaultArtifactCache()
+	if cache == nil || spec.CompileCmd == nil {
+		return "", CompileResult{}, nil, false, nil
+	}
+
+	version, err := toolchain()
+	if err != nil || version == "" {
+		return "", CompileResult{}, nil, false, err
+	}
+
+	key := artifactKey(spec, version, files)
+	compile, snapshot, ok := cache.Get(key)
+	return key, compile, snapshot, ok, nil
+}
+
+// storeArtifact caches a successful compilation under the key returned by lookupArtifact.
+func storeArtifact(key string, compile CompileResult, snapshot []byte) {
+	cache := DefaultArtifactCache()
+	if cache == nil || key == "" || !compile.Success {
+		return
+	}
+
+	if err := cache.Put(key, compile, snapshot); err != nil {
+		log.Printf("Failed to cache artifact: %v", err)
+	}
+}
+
+// artifactKey returns the cache key of compiling the files with the compile command of the language under the toolchain version.
+func artifactKey(spec LanguageSpec, toolchain string, files []File) string {
+	hash := sha256.New()
+	write := func(data []byte) {
+		// Length prefixes keep the fields from running into each other
+		binary.Write(hash, binary.BigEndian, uint64(len(data)))
+		hash.Write(data)
+	}
+
+	write([]byte(spec.ID))
+	write([]byte(toolchain))
+	for _, arg := range spec.CompileCmd {
+		write([]byte(arg))
+	}
+	for _, env := range spec.Env {
+		write([]byte(env))
+	}
+	for _, file := range files {
+		write([]byte(file.Name))
+		write(file.Content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
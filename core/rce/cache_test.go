@@ -0,0 +1,120 @@
+package rce
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactCache(t *testing.T) {
+	compile := CompileResult{Success: true}
+	snapshot := bytes.Repeat([]byte("a"), 30)
+	meta, err := json.Marshal(compile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Room for two entries
+	maxBytes := int64(len(snapshot)+len(meta)) * 5 / 2
+
+	dir := t.TempDir()
+	cache, err := NewArtifactCache(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := cache.Get("a"); ok {
+		t.Fatal("hit in an empty cache")
+	}
+	if err := cache.Put("a", compile, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	got, archive, ok := cache.Get("a")
+	if !ok || !got.Cached || !got.Success || !bytes.Equal(archive, snapshot) {
+		t.Fatalf("Get() = %+v, %q, %v", got, archive, ok)
+	}
+
+	// b is used after a, so c evicts a
+	if err := cache.Put("b", compile, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	cache.Get("b")
+	if err := cache.Put("c", compile, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	for key, present := range map[string]bool{"a": false, "b": true, "c": true} {
+		if _, _, ok := cache.Get(key); ok != present {
+			t.Fatalf("entry %s present %v, want %v", key, ok, present)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.tar")); !os.IsNotExist(err) {
+		t.Fatalf("archive of an evicted entry left on disk: %v", err)
+	}
+
+	// Too large to fit at all
+	if err := cache.Put("d", compile, bytes.Repeat([]byte("a"), int(maxBytes))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := cache.Get("d"); ok {
+		t.Fatal("entry larger than the cache was stored")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 4 || stats.Misses != 3 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	// Entries survive a restart, an archive without its compile result does not
+	if err := os.WriteFile(filepath.Join(dir, "e.tar"), snapshot, 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewArtifactCache(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := reopened.Stats(); stats.Entries != 2 || stats.Bytes != cache.Stats().Bytes {
+		t.Fatalf("stats %+v after reopening, want %+v", stats, cache.Stats())
+	}
+	if _, _, ok := reopened.Get("c"); !ok {
+		t.Fatal("entry lost on reopening")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "e.tar")); !os.IsNotExist(err) {
+		t.Fatalf("incomplete entry left on disk: %v", err)
+	}
+}
+
+func TestArtifactKey(t *testing.T) {
+	spec, err := lookupLanguage(C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []File{{Name: "main.c", Content: []byte("int main() {}")}}
+	key := artifactKey(spec, "gcc 13", files)
+
+	other := spec
+	other.CompileCmd = append([]string{"gcc", "-O2"}, spec.CompileCmd[1:]...)
+
+	tests := []struct {
+		name      string
+		spec      LanguageSpec
+		toolchain string
+		files     []File
+		same      bool
+	}{
+		{"same", spec, "gcc 13", []File{{Name: "main.c", Content: []byte("int main() {}")}}, true},
+		{"other toolchain", spec, "gcc 14", files, false},
+		{"other compile command", other, "gcc 13", files, false},
+		{"other content", spec, "gcc 13", []File{{Name: "main.c", Content: []byte("int main() { }")}}, false},
+		{"other name", spec, "gcc 13", []File{{Name: "solve.c", Content: []byte("int main() {}")}}, false},
+		{"boundary moved", spec, "gcc 13", []File{{Name: "main.ci", Content: []byte("nt main() {}")}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := artifactKey(test.spec, test.toolchain, test.files); (got == key) != test.same {
+				t.Fatalf("key %s, key of the files %s, want same %v", got, key, test.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CheckerKind selects how the output of a program is compared with the expected output.
+type CheckerKind string
+
+const (
+	CheckerExact           CheckerKind = "exact"            // Byte for byte up to trailing whitespace, other differences in whitespace only are a presentation error
+	CheckerWhitespace      CheckerKind = "whitespace"       // Equal once every whitespace character is removed
+	CheckerLines           CheckerKind = "lines"            // Line by line, ignoring trailing whitespace and trailing blank lines
+	CheckerTokens          CheckerKind = "tokens"           // Whitespace separated tokens
+	CheckerCaseInsensitive CheckerKind = "case-insensitive" // Tokens, ignoring case
+	CheckerFloat           CheckerKind = "float"            // Tokens, numbers within the tolerance
+	CheckerCustom          CheckerKind = "custom"           // Teacher supplied program with testlib exit codes
+)
+
+// DefaultFloatTolerance is the absolute or relative error the float checker accepts when none is set.
+const DefaultFloatTolerance = 1e-6
+
+// Files a custom checker finds in its working directory, also passed as its arguments in this order like testlib expects.
+const (
+	CheckerInputFile  = "input.txt"
+	CheckerOutputFile = "output.txt"
+	CheckerAnswerFile = "answer.txt"
+)
+
+// Exit codes of testlib checkers and interactors besides 0, which accepts the output.
+const (
+	testlibWrongAnswer       = 1
+	testlibPresentationError = 2
+	testlibFail              = 3 // The checker itself failed
+)
+
+// CheckerSpec is the checker configured for a question.
+type CheckerSpec struct {
+	Kind      CheckerKind `json:"kind"`
+	Tolerance float64     `json:"tolerance,omitempty"` // Float checker only
+	Program   string      `json:"program,omitempty"`   // Custom checker only, its source code
+	Language  Language    `json:"language,omitempty"`  // Custom checker only
+}
+
+// CheckResult is the verdict of a checker on one output.
+type CheckResult struct {
+	Verdict Verdict // Accepted, wrong answer or presentation error
+	Message string  // Why the output was not accepted
+}
+
+// Checker decides whether the output of a program answers a test case.
+// Checkers holding resources implement io.Closer and must be closed once the job is done.
+type Checker interface {
+	Check(ctx context.Context, input Input, output string, expected string) (CheckResult, error)
+}
+
+// Validate checks that the spec describes a usable checker.
+func (s CheckerSpec) Validate() error {
+	switch s.Kind {
+	case CheckerExact, CheckerWhitespace, CheckerLines, CheckerTokens, CheckerCaseInsensitive:
+		return nil
+	case CheckerFloat:
+		if s.Tolerance < 0 {
+			return fmt.Errorf("invalid float checker tolerance: %v", s.Tolerance)
+		}
+		return nil
+	case CheckerCustom:
+		if s.Program == "" {
+			return fmt.Errorf("custom checker has no program")
+		}
+		_, err := lookupLanguage(s.Language)
+		return err
+	default:
+		return fmt.Errorf("unsupported checker: %s", s.Kind)
+	}
+}
+
+// NewChecker creates the checker described by the spec. A custom checker is compiled with the runner right away.
+func NewChecker(ctx context.Context, runner Runner, spec CheckerSpec) (Checker, error) {
+	return newChecker(ctx, runner, spec, 0)
+}
+
+// newChecker creates the checker described by the spec, for a job taking up to the wall time budget.
+func newChecker(ctx context.Context, runner Runner, spec CheckerSpec, budget time.Duration) (Checker, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch spec.Kind {
+	case CheckerWhitespace:
+		return compareChecker(compareWithoutWhitespace), nil
+	case CheckerLines:
+		return compareChecker(compareLines), nil
+	case CheckerTokens:
+		return compareChecker(func(output, expected string) CheckResult {
+			return compareTokens(output, expected, func(got, want string) bool { return got == want })
+		}), nil
+	case CheckerCaseInsensitive:
+		return compareChecker(func(output, expected string) CheckResult {
+			return compareTokens(output, expected, strings.EqualFold)
+		}), nil
+	case CheckerFloat:
+		tolerance := spec.Tolerance
+		if tolerance == 0 {
+			tolerance = DefaultFloatTolerance
+		}
+		return compareChecker(func(output, expected string) CheckResult {
+			return compareTokens(output, expected, func(got, want string) bool { return floatTokensEqual(got, want, tolerance) })
+		}), nil
+	case CheckerCustom:
+		return newCustomChecker(ctx, runner, spec, budget)
+	default:
+		return compareChecker(compareExact), nil
+	}
+}
+
+// compareChecker is a checker that only compares the output with the expected output.
+type compareChecker func(output, expected string) CheckResult
+
+func (c compareChecker) Check(ctx context.Context, input Input, output string, expected string) (CheckResult, error) {
+	return c(output, expected), nil
+}
+
+// compareExact accepts output identical to the expected output once trailing whitespace is removed, so a missing or extra final newline
+// does not matter, and reports output differing only in other whitespace as a presentation error.
+func compareExact(output, expected string) CheckResult {
+	if strings.TrimRightFunc(output, unicode.IsSpace) == strings.TrimRightFunc(expected, unicode.IsSpace) {
+		return CheckResult{Verdict: VerdictAccepted}
+	}
+	if strings.Join(strings.Fields(output), " ") == strings.Join(strings.Fields(expected), " ") {
+		return CheckResult{Verdict: VerdictPresentationError, Message: "output differs in whitespace only"}
+	}
+	return compareLines(output, expected)
+}
+
+// compareWithoutWhitespace accepts output equal to the expected output once every whitespace character is removed.
+func compareWithoutWhitespace(output, expected string) CheckResult {
+	strip := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+
+	got, want := strip(output), strip(expected)
+	if got == want {
+		return CheckResult{Verdict: VerdictAccepted}
+	}
+
+	at := 0
+	for at < len(got) && at < len(want) && got[at] == want[at] {
+		at++
+	}
+	return CheckResult{
+		Verdict: VerdictWrongAnswer,
+		Message: fmt.Sprintf("differs at character %d", at+1),
+	}
+}
+
+// compareLines accepts output with the same lines, ignoring trailing whitespace on every line and trailing blank lines.
+func compareLines(output, expected string) CheckResult {
+	got, want := outputLines(output), outputLines(expected)
+
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("output ends before line %d", i+1)}
+		case i >= len(want):
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("line %d is past the end of the expected output", i+1)}
+		case got[i] != want[i]:
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("line %d differs", i+1)}
+		}
+	}
+	return CheckResult{Verdict: VerdictAccepted}
+}
+
+// outputLines splits the output into lines without trailing whitespace, dropping trailing blank lines.
+func outputLines(output string) []string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// compareTokens accepts output whose whitespace separated tokens all match the expected ones.
+func compareTokens(output, expected string, match func(got, want string) bool) CheckResult {
+	got, want := strings.Fields(output), strings.Fields(expected)
+
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("output ends before token %d", i+1)}
+		case i >= len(want):
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("token %d is past the end of the expected output", i+1)}
+		case !match(got[i], want[i]):
+			return CheckResult{Verdict: VerdictWrongAnswer, Message: fmt.Sprintf("token %d differs", i+1)}
+		}
+	}
+	return CheckResult{Verdict: VerdictAccepted}
+}
+
+// floatTokensEqual compares numbers within the absolute or relative tolerance and any other tokens exactly.
+func floatTokensEqual(got, want string, tolerance float64) bool {
+	wantValue, err := strconv.ParseFloat(want, 64)
+	if err != nil {
+		return got == want
+	}
+	gotValue, err := strconv.ParseFloat(got, 64)
+	if err != nil || math.IsNaN(gotValue) {
+		return false
+	}
+
+	diff := math.Abs(gotValue - wantValue)
+	return diff <= tolerance || diff <= tolerance*math.Abs(wantValue)
+}
+
+// customChecker runs a teacher supplied checker program in its own sandbox.
+// The program gets the input, the output and the expected output as files and answers with a testlib exit code.
+type customChecker struct {
+	*helperProgram
+}
+
+// newCustomChecker compiles the checker program of the spec.
+func newCustomChecker(ctx context.Context, runner Runner, spec CheckerSpec, budget time.Duration) (*customChecker, error) {
+	helper, err := newHelperProgram(ctx, runner, "checker", spec.Program, spec.Language, budget)
+	if err != nil {
+		return nil, err
+	}
+	helper.sandbox.Args = []string{CheckerInputFile, CheckerOutputFile, CheckerAnswerFile}
+	return &customChecker{helper}, nil
+}
+
+func (c *customChecker) Check(ctx context.Context, input Input, output string, expected string) (CheckResult, error) {
+	inputData, err := readInput(input)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	err = c.prepare(ctx, []File{
+		{Name: CheckerInputFile, Content: inputData},
+		{Name: CheckerOutputFile, Content: []byte(output)},
+		{Name: CheckerAnswerFile, Content: []byte(expected)},
+	})
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	result, err := c.runner.Run(ctx, c.sandbox, strings.NewReader(""), LimitsFor(c.sandbox.Language))
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	return testlibVerdict(c.name, result, result.Stderr+result.Stdout)
+}
+
+// helperProgram is a teacher supplied program, like a checker or an interactor, compiled once and run in its own sandbox for every test case.
+type helperProgram struct {
+	name    string
+	runner  Runner
+	sandbox *Sandbox
+	runs    int
+}
+
+// newHelperProgram compiles the program into a new sandbox that lives as long as a job taking up to the wall time budget.
+func newHelperProgram(ctx context.Context, runner Runner, name string, program string, language Language, budget time.Duration) (*helperProgram, error) {
+	sandbox, compile, err := runner.Compile(ctx, program, language, nil, CompileOptions{Budget: budget})
+	if err != nil {
+		return nil, err
+	}
+	if !compile.Success {
+		runner.Cleanup(sandbox)
+		return nil, fmt.Errorf("%s failed to compile: %s", name, compile.Diagnostics)
+	}
+
+	return &helperProgram{name: name, runner: runner, sandbox: sandbox}, nil
+}
+
+// prepare resets the sandbox after the previous run and places the files of the next one.
+func (h *helperProgram) prepare(ctx context.Context, files []File) error {
+	if h.runs > 0 {
+		if err := h.runner.Reset(ctx, h.sandbox); err != nil {
+			return err
+		}
+	}
+	h.runs++
+
+	return h.runner.AddFiles(ctx, h.sandbox, files)
+}
+
+// Close releases the sandbox of the program.
+func (h *helperProgram) Close() error {
+	if err := h.runner.Cleanup(h.sandbox); err != nil {
+		log.Printf("Failed to clean up %s sandbox: %v", h.name, err)
+		return err
+	}
+	return nil
+}
+
+// readInput reads the whole input.
+func readInput(input Input) ([]byte, error) {
+	reader, err := input.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// testlibVerdict maps the testlib exit code of a checker or interactor run to a verdict with the message it printed.
+func testlibVerdict(program string, result ExecutionResult, message string) (CheckResult, error) {
+	message = strings.TrimSpace(message)
+	switch {
+	case result.Verdict == VerdictOK:
+		return CheckResult{Verdict: VerdictAccepted, Message: message}, nil
+	case result.Verdict == VerdictRuntimeError && result.ExitCode == testlibWrongAnswer:
+		return CheckResult{Verdict: VerdictWrongAnswer, Message: message}, nil
+	case result.Verdict == VerdictRuntimeError && result.ExitCode == testlibPresentationError:
+		return CheckResult{Verdict: VerdictPresentationError, Message: message}, nil
+	case result.Verdict == VerdictRuntimeError && result.ExitCode == testlibFail:
+		return CheckResult{}, fmt.Errorf("%s failed: %s", program, message)
+	default:
+		return CheckResult{}, fmt.Errorf("%s ended with %s (exit code %d): %s", program, result.Verdict, result.ExitCode, message)
+	}
+}
@@ -0,0 +1,103 @@
+package rce
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompareCheckers(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     CheckerSpec
+		output   string
+		expected string
+		verdict  Verdict
+	}{
+		{"exact equal", CheckerSpec{Kind: CheckerExact}, "1 2\n3\n", "1 2\n3\n", VerdictAccepted},
+		{"exact missing final newline", CheckerSpec{Kind: CheckerExact}, "1 2\n3", "1 2\n3\n", VerdictAccepted},
+		{"exact extra trailing whitespace", CheckerSpec{Kind: CheckerExact}, "1 2\n3\n\n  ", "1 2\n3\n", VerdictAccepted},
+		{"exact inner whitespace", CheckerSpec{Kind: CheckerExact}, "1  2\n3\n", "1 2\n3\n", VerdictPresentationError},
+		{"exact different", CheckerSpec{Kind: CheckerExact}, "1 2\n4\n", "1 2\n3\n", VerdictWrongAnswer},
+		{"whitespace ignored", CheckerSpec{Kind: CheckerWhitespace}, "a b\tc\n", "abc", VerdictAccepted},
+		{"whitespace different", CheckerSpec{Kind: CheckerWhitespace}, "a b d", "abc", VerdictWrongAnswer},
+		{"lines trailing spaces", CheckerSpec{Kind: CheckerLines}, "a  \nb\n\n", "a\nb", VerdictAccepted},
+		{"lines leading spaces", CheckerSpec{Kind: CheckerLines}, " a\nb", "a\nb", VerdictWrongAnswer},
+		{"lines missing line", CheckerSpec{Kind: CheckerLines}, "a", "a\nb", VerdictWrongAnswer},
+		{"tokens", CheckerSpec{Kind: CheckerTokens}, "1\n2   3", "1 2 3", VerdictAccepted},
+		{"tokens extra", CheckerSpec{Kind: CheckerTokens}, "1 2 3 4", "1 2 3", VerdictWrongAnswer},
+		{"case insensitive", CheckerSpec{Kind: CheckerCaseInsensitive}, "YES no", "yes NO", VerdictAccepted},
+		{"case insensitive different", CheckerSpec{Kind: CheckerCaseInsensitive}, "yes", "no", VerdictWrongAnswer},
+		{"float default tolerance", CheckerSpec{Kind: CheckerFloat}, "0.3333333", "0.333333333", VerdictAccepted},
+		{"float outside tolerance", CheckerSpec{Kind: CheckerFloat}, "0.33", "0.333333333", VerdictWrongAnswer},
+		{"float relative tolerance", CheckerSpec{Kind: CheckerFloat, Tolerance: 1e-3}, "1000500", "1000000", VerdictAccepted},
+		{"float words compared exactly", CheckerSpec{Kind: CheckerFloat}, "answer 1.0", "answer 1", VerdictAccepted},
+		{"float nan", CheckerSpec{Kind: CheckerFloat}, "nan", "1", VerdictWrongAnswer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker, err := NewChecker(context.Background(), nil, test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := checker.Check(context.Background(), StringInput(""), test.output, test.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Verdict != test.verdict {
+				t.Fatalf("verdict %s, want %s (%s)", result.Verdict, test.verdict, result.Message)
+			}
+			if result.Verdict != VerdictAccepted && result.Message == "" {
+				t.Fatal("no message for an output that was not accepted")
+			}
+		})
+	}
+}
+
+func TestCompareCheckersHideExpectedOutput(t *testing.T) {
+	// Messages reach students, who must not learn the expected output of hidden tests from them
+	const expected = "hidden answer\n"
+	outputs := []string{"", "hidden\n", "hidden answer\nextra\n", "other\n"}
+
+	for _, kind := range []CheckerKind{CheckerExact, CheckerWhitespace, CheckerLines, CheckerTokens, CheckerCaseInsensitive, CheckerFloat} {
+		checker, err := NewChecker(context.Background(), nil, CheckerSpec{Kind: kind})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, output := range outputs {
+			result, err := checker.Check(context.Background(), StringInput(""), output, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(result.Message, "answer") {
+				t.Fatalf("%s checker message %q quotes the expected output", kind, result.Message)
+			}
+		}
+	}
+}
+
+func TestCheckerSpecValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  CheckerSpec
+		valid bool
+	}{
+		{"exact", CheckerSpec{Kind: CheckerExact}, true},
+		{"float", CheckerSpec{Kind: CheckerFloat, Tolerance: 0.01}, true},
+		{"negative tolerance", CheckerSpec{Kind: CheckerFloat, Tolerance: -1}, false},
+		{"custom", CheckerSpec{Kind: CheckerCustom, Program: "int main() {}", Language: CPP}, true},
+		{"custom without program", CheckerSpec{Kind: CheckerCustom, Language: CPP}, false},
+		{"custom unknown language", CheckerSpec{Kind: CheckerCustom, Program: "x", Language: "cobol"}, false},
+		{"unknown kind", CheckerSpec{Kind: "regex"}, false},
+		{"empty kind", CheckerSpec{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.spec.Validate(); (err == nil) != test.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package rce
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severities of compiler diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// maxDiagnostics caps the diagnostics parsed from the output of a single compilation.
+const maxDiagnostics = 50
+
+// Diagnostic is an error, warning or note parsed from the output of a compiler.
+type Diagnostic struct {
+	File     string       `json:"file,omitempty"`   // Submission file, or the header or library the diagnostic is in
+	Line     int          `json:"line,omitempty"`   // Line in the code as submitted, 0 when unknown or in code a harness generated
+	Column   int          `json:"column,omitempty"` // 1-based, 0 when unknown
+	Severity string       `json:"severity"`
+	Message  string       `json:"message"`
+	Notes    []Diagnostic `json:"notes,omitempty"` // Notes the compiler attached, like the declaration a call does not match
+}
+
+// diagnosticsParser parses the output of a compiler. The source is the compiled program, for compilers that only print parts of its lines,
+// and names are the files of the program.
+type diagnosticsParser func(output string, source string, names map[string]bool) []Diagnostic
+
+// diagnosticsParsers are the compiler output formats a language can use, by name.
+var diagnosticsParsers = map[string]diagnosticsParser{
+	"gcc":    parseGCCDiagnostics,
+	"javac":  parseJavacDiagnostics,
+	"python": parsePythonDiagnostics,
+}
+
+// runtimeDiagnostics are the formats of diagnosticsParsers that errors at run time are printed in too, so stderr of runs is parsed with them.
+var runtimeDiagnostics = map[string]bool{
+	"python": true,
+}
+
+var (
+	// main.c:5:3: error: expected ';' before '}' token
+	gccDiagnosticPattern = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+	// collect2: error: ld returned 1 exit status
+	gccToolPattern = regexp.MustCompile(`^([^\s:]+): (fatal error|error|warning): (.*)$`)
+	// /usr/bin/ld: main.c:(.text+0x5): undefined reference to `foo'
+	linkerPattern = regexp.MustCompile(`^(?:\S*ld: )?([^\s:]+):\(\.[^)]*\): (.*)$`)
+
+	// Main.java:3: error: ';' expected
+	javacDiagnosticPattern = regexp.MustCompile(`^(.+\.java):(\d+): (error|warning): (.*)$`)
+	// warning: [options] bootstrap class path not set
+	javacToolPattern = regexp.MustCompile(`^(error|warning): (.*)$`)
+	// Note: Main.java uses unchecked or unsafe operations.
+	javacNotePattern = regexp.MustCompile(`^Note: (.*)$`)
+
+	//   File "main.py", line 3, in f
+	pythonFramePattern = regexp.MustCompile(`^\s*File "(.+)", line (\d+)(?:, in (.+))?$`)
+	// ZeroDivisionError: division by zero
+	pythonExceptionPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*): (.*)$`)
+	// Sorry: IndentationError: unexpected indent (main.py, line 2)
+	pythonSorryPattern = regexp.MustCompile(`^Sorry: ([A-Za-z_][\w.]*): (.*) \((.+), line (\d+)\)$`)
+	// Line of carets and tildes under the code a diagnostic points at
+	caretPattern = regexp.MustCompile(`^\s*[~^]*\^[~^]*\s*$`)
+)
+
+// parseDiagnostics parses the compiler output, or the stderr of a run, of a program of the language built from the code of a submission.
+// The code starts lineOffset lines into the source file of the program; lines outside of it are generated code and reported as 0.
+func parseDiagnostics(spec LanguageSpec, output string, program string, code string, files []File, lineOffset int) []Diagnostic {
+	parse, ok := diagnosticsParsers[spec.Diagnostics]
+	if !ok || output == "" {
+		return nil
+	}
+
+	names := map[string]bool{spec.SourceFile: true}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+	submissionLines := strings.Count(code, "\n") + 1
+
+	diagnostics := parse(output, program, names)
+	if len(diagnostics) > maxDiagnostics {
+		diagnostics = diagnostics[:maxDiagnostics]
+	}
+	for i := range diagnostics {
+		remapDiagnostic(&diagnostics[i], spec.SourceFile, names, lineOffset, submissionLines)
+	}
+	return diagnostics
+}
+
+// remapDiagnostic reports the diagnostic and its notes relative to the submission.
+func remapDiagnostic(d *Diagnostic, sourceFile string, names map[string]bool, lineOffset int, submissionLines int) {
+	if file := submissionFile(d.File, names); file != "" {
+		d.File = file
+	}
+
+	if d.File == sourceFile && d.Line > 0 {
+		d.Line -= lineOffset
+		if d.Line < 1 || d.Line > submissionLines {
+			d.Line, d.Column = 0, 0
+		}
+	}
+
+	for i := range d.Notes {
+		remapDiagnostic(&d.Notes[i], sourceFile, names, lineOffset, submissionLines)
+	}
+}
+
+// parseGCCDiagnostics parses the output of gcc and g++, attaching every note to the diagnostic before it.
+func parseGCCDiagnostics(output string, source string, names map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		var d Diagnostic
+		if match := gccDiagnosticPattern.FindStringSubmatch(line); match != nil {
+			d.File, d.Message = match[1], strings.TrimSpace(match[5])
+			d.Line, _ = strconv.Atoi(match[2])
+			d.Column, _ = strconv.Atoi(match[3])
+			d.Severity = gccSeverity(match[4])
+		} else if match := linkerPattern.FindStringSubmatch(line); match != nil {
+			d = Diagnostic{File: match[1], Severity: SeverityError, Message: match[2]}
+		} else if match := gccToolPattern.FindStringSubmatch(line); match != nil {
+			d = Diagnostic{Severity: gccSeverity(match[2]), Message: match[1] + ": " + match[3]}
+		} else {
+			// Source excerpts, carets and context like "In function 'main':"
+			continue
+		}
+
+		if d.Severity == SeverityNote && len(diagnostics) > 0 {
+			last := &diagnostics[len(diagnostics)-1]
+			last.Notes = append(last.Notes, d)
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// gccSeverity returns the severity of a gcc diagnostic kind.
+func gccSeverity(kind string) string {
+	if kind == "fatal error" {
+		return SeverityError
+	}
+	return kind
+}
+
+// parseJavacDiagnostics parses the output of javac. The column comes from the caret under the source line,
+// the indented details after it (symbol, location) are added to the message.
+func parseJavacDiagnostics(output string, source string, names map[string]bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	var current *Diagnostic
+	caretSeen := false
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if match := javacDiagnosticPattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			diagnostics = append(diagnostics, Diagnostic{File: match[1], Line: lineNumber, Severity: match[3], Message: match[4]})
+			current, caretSeen = &diagnostics[len(diagnostics)-1], false
+			continue
+		}
+		if match := javacNotePattern.FindStringSubmatch(line); match != nil {
+			diagnostics = append(diagnostics, Diagnostic{Severity: SeverityNote, Message: match[1]})
+			current = nil
+			continue
+		}
+		if match := javacToolPattern.FindStringSubmatch(line); match != nil {
+			diagnostics = append(diagnostics, Diagnostic{Severity: match[1], Message: match[2]})
+			current = nil
+			continue
+		}
+
+		switch {
+		case current == nil:
+		case !caretSeen && caretPattern.MatchString(line):
+			current.Column = strings.Index(line, "^") + 1
+			caretSeen = true
+		case caretSeen && strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "":
+			current.Message += "\n" + strings.TrimSpace(line)
+		case caretSeen:
+			// "1 error" and the like end the details
+			current = nil
+		}
+	}
+	return diagnostics
+}
+
+// pythonFrame is a frame of a Python traceback or the location of a syntax error.
+type pythonFrame struct {
+	file     string
+	line     int
+	function string
+	text     string // Source line as printed
+	column   int
+}
+
+// parsePythonDiagnostics parses syntax errors and tracebacks printed by Python into one error each, placed at the
+// innermost frame in a submission file. The frames around it become notes, outermost first.
+func parsePythonDiagnostics(output string, source string, names map[string]bool) []Diagnostic {
+	sourceLines := strings.Split(source, "\n")
+
+	var diagnostics []Diagnostic
+	var frames []pythonFrame
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if match := pythonSorryPattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[4])
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     match[3],
+				Line:     lineNumber,
+				Severity: SeverityError,
+				Message:  match[1] + ": " + match[2],
+			})
+			frames = nil
+			continue
+		}
+
+		if match := pythonFramePattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			frames = append(frames, pythonFrame{file: match[1], line: lineNumber, function: match[3]})
+			continue
+		}
+		if len(frames) == 0 {
+			continue
+		}
+
+		frame := &frames[len(frames)-1]
+		switch {
+		case caretPattern.MatchString(line) && frame.text != "":
+			frame.column = pythonColumn(frame, line, sourceLines)
+		case strings.HasPrefix(line, "    ") && frame.text == "":
+			frame.text = line[4:]
+		case pythonExceptionPattern.MatchString(line) && !strings.HasPrefix(line, " "):
+			diagnostics = append(diagnostics, newPythonDiagnostic(frames, line, names))
+			frames = nil
+		}
+	}
+	return diagnostics
+}
+
+// pythonColumn returns the column of the caret under the printed source line of the frame.
+// Python may print the line without its indentation, so the column is found in the source when the frame is in it.
+func pythonColumn(frame *pythonFrame, caretLine string, sourceLines []string) int {
+	if len(caretLine) < 4 {
+		return 0
+	}
+	caret := strings.Index(caretLine[4:], "^")
+	column := caret + 1
+
+	trimmed := strings.TrimLeft(frame.text, " \t")
+	indent := len(frame.text) - len(trimmed)
+	if frame.line >= 1 && frame.line <= len(sourceLines) {
+		if start := strings.Index(sourceLines[frame.line-1], trimmed); start >= 0 && trimmed != "" {
+			column = start + caret - indent + 1
+		}
+	}
+	return column
+}
+
+// newPythonDiagnostic builds the error of the exception line, placed at the innermost frame in the program.
+func newPythonDiagnostic(frames []pythonFrame, exception string, names map[string]bool) Diagnostic {
+	at := len(frames) - 1
+	for i := len(frames) - 1; i >= 0; i-- {
+		if submissionFile(frames[i].file, names) != "" {
+			at = i
+			break
+		}
+	}
+
+	d := Diagnostic{
+		File:     frames[at].file,
+		Line:     frames[at].line,
+		Column:   frames[at].column,
+		Severity: SeverityError,
+		Message:  exception,
+	}
+	for i, frame := range frames {
+		if i == at || frame.function == "" {
+			continue
+		}
+		d.Notes = append(d.Notes, Diagnostic{
+			File:     frame.file,
+			Line:     frame.line,
+			Severity: SeverityNote,
+			Message:  "in " + frame.function,
+		})
+	}
+	return d
+}
@@ -0,0 +1,125 @@
+package rce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name       string
+		language   Language
+		output     string
+		program    string
+		code       string
+		lineOffset int
+		want       []Diagnostic
+	}{
+		{
+			name:     "gcc",
+			language: C,
+			output: "main.c: In function 'main':\n" +
+				"main.c:3:5: error: expected ';' before '}' token\n" +
+				"    3 |     return 0\n" +
+				"      |     ^~~~~~\n" +
+				"/workspace/main.c:2:9: warning: unused variable 'x' [-Wunused-variable]\n" +
+				"/workspace/main.c:1:5: note: declared here\n",
+			program: "int main() {\n\tint x;\n\treturn 0\n}\n",
+			code:    "int main() {\n\tint x;\n\treturn 0\n}\n",
+			want: []Diagnostic{
+				{File: "main.c", Line: 3, Column: 5, Severity: SeverityError, Message: "expected ';' before '}' token"},
+				{File: "main.c", Line: 2, Column: 9, Severity: SeverityWarning, Message: "unused variable 'x' [-Wunused-variable]", Notes: []Diagnostic{
+					{File: "main.c", Line: 1, Column: 5, Severity: SeverityNote, Message: "declared here"},
+				}},
+			},
+		},
+		{
+			name:     "gcc linker",
+			language: C,
+			output: "/usr/bin/ld: main.c:(.text+0x5): undefined reference to `solve'\n" +
+				"collect2: error: ld returned 1 exit status\n",
+			program: "int main() { solve(); }\n",
+			code:    "int main() { solve(); }\n",
+			want: []Diagnostic{
+				{File: "main.c", Severity: SeverityError, Message: "undefined reference to `solve'"},
+				{Severity: SeverityError, Message: "collect2: ld returned 1 exit status"},
+			},
+		},
+		{
+			name:     "gcc harness",
+			language: C,
+			output: "main.c:4:2: error: 'y' undeclared (first use in this function)\n" +
+				"main.c:7:10: error: too few arguments to function 'add'\n",
+			program:    "#include <stdio.h>\n#define main student_main\nint add(int a, int b) {\n\treturn y;\n}\nint main(void) {\n\treturn add(1);\n}\n",
+			code:       "int add(int a, int b) {\n\treturn y;\n}",
+			lineOffset: 2,
+			want: []Diagnostic{
+				{File: "main.c", Line: 2, Column: 2, Severity: SeverityError, Message: "'y' undeclared (first use in this function)"},
+				{File: "main.c", Severity: SeverityError, Message: "too few arguments to function 'add'"},
+			},
+		},
+		{
+			name:     "javac",
+			language: JAVA,
+			output: "Main.java:3: error: cannot find symbol\n" +
+				"        int y = x;\n" +
+				"                ^\n" +
+				"  symbol:   variable x\n" +
+				"  location: class Main\n" +
+				"1 error\n",
+			program: "class Main {\n    public static void main(String[] args) {\n        int y = x;\n    }\n}\n",
+			code:    "class Main {\n    public static void main(String[] args) {\n        int y = x;\n    }\n}\n",
+			want: []Diagnostic{
+				{File: "Main.java", Line: 3, Column: 17, Severity: SeverityError, Message: "cannot find symbol\nsymbol:   variable x\nlocation: class Main"},
+			},
+		},
+		{
+			name:     "python syntax error",
+			language: PYTHON,
+			output:   "Sorry: IndentationError: unexpected indent (main.py, line 2)\n",
+			program:  "x = 1\n  y = 2\n",
+			code:     "x = 1\n  y = 2\n",
+			want: []Diagnostic{
+				{File: "main.py", Line: 2, Severity: SeverityError, Message: "IndentationError: unexpected indent"},
+			},
+		},
+		{
+			name:     "python traceback",
+			language: PYTHON,
+			output: "Traceback (most recent call last):\n" +
+				"  File \"/workspace/main.py\", line 4, in <module>\n" +
+				"    print(f(0))\n" +
+				"          ^^^^\n" +
+				"  File \"/workspace/main.py\", line 2, in f\n" +
+				"    return 1 / x\n" +
+				"           ~~^~~\n" +
+				"ZeroDivisionError: division by zero\n",
+			program: "def f(x):\n    return 1 / x\n\nprint(f(0))\n",
+			code:    "def f(x):\n    return 1 / x\n\nprint(f(0))\n",
+			want: []Diagnostic{
+				{File: "main.py", Line: 2, Column: 14, Severity: SeverityError, Message: "ZeroDivisionError: division by zero", Notes: []Diagnostic{
+					{File: "main.py", Line: 4, Severity: SeverityNote, Message: "in <module>"},
+				}},
+			},
+		},
+		{
+			name:     "no output",
+			language: C,
+			program:  "int main() {}\n",
+			code:     "int main() {}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := lookupLanguage(test.language)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := parseDiagnostics(spec, test.output, test.program, test.code, nil, test.lineOffset)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("parseDiagnostics() =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,770 @@
+package rce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// idleCmd keeps the container running between the commands executed in it.
+var idleCmd = []string{"sleep", "infinity"}
+
+// DockerRunner runs programs in Docker containers.
+// Every sandbox is one container; the compiler and each run are executed in it so runs reuse the artifact.
+type DockerRunner struct {
+	apiClient *client.Client
+	instance  string // Identifies the containers of this runner among those of other runners on the host
+
+	mu          sync.Mutex
+	warm        *warmPool            // Idle started containers, nil when the warm pool is disabled
+	active      map[string]time.Time // Deadline of every container hosting a sandbox by ID, a container is either here or idle in warm
+	reaperStats ReaperStats
+}
+
+// NewDockerRunner creates a new DockerRunner using the Docker environment configuration.
+func NewDockerRunner() (*DockerRunner, error) {
+	apiClient, err := createNewAPIClient()
+	if err != nil {
+		log.Printf("Failed to create Docker client: %v", err)
+		return nil, err
+	}
+
+	return &DockerRunner{
+		apiClient: apiClient,
+		instance:  NewID(),
+		active:    map[string]time.Time{},
+	}, nil
+}
+
+// Compile takes a warm container or starts a new one, copies the files into its workspace and runs the compiler in it.
+// A cached artifact of the same files and toolchain is restored instead of compiling again.
+func (d *DockerRunner) Compile(ctx context.Context, program string, language Language, files []File, opts CompileOptions) (*Sandbox, CompileResult, error) {
+	spec, err := lookupCompileSpec(language, opts)
+	if err != nil {
+		return nil, CompileResult{}, err
+	}
+
+	all, err := sandboxFiles(spec, program, files)
+	if err != nil {
+		return nil, CompileResult{}, err
+	}
+
+	// The image ID pins the toolchain version of cached artifacts
+	key, cached, snapshot, hit, err := lookupArtifact(spec, all, func() (string, error) {
+		return imageID(ctx, d.apiClient, spec.Image)
+	})
+	if err != nil {
+		log.Printf("Failed to look up cached artifact: %v", err)
+		return nil, CompileResult{}, err
+	}
+
+	// Warm containers run the image of the language with its default resources
+	containerID, ok := "", false
+	if warm := d.warmPool(); warm != nil && opts.pooled(spec) {
+		containerID, ok = d.takeWarm(warm, spec.ID, opts.lifetime())
+	}
+	if !ok {
+		containerID, err = startSandboxContainer(ctx, d.apiClient, spec, opts.resources(spec), d.sandboxLabels(time.Now().Add(opts.lifetime())))
+		if err != nil {
+			log.Printf("Failed to start Docker container: %v", err)
+			return nil, CompileResult{}, err
+		}
+		d.activate(containerID, opts.lifetime())
+	}
+
+	sandbox := &Sandbox{
+		ID:       containerID,
+		Language: language,
+		Program:  program,
+		Files:    all,
+		spec:     spec,
+		options:  opts,
+	}
+
+	discard := func() {
+		d.deactivate(sandbox.ID)
+		removeContainer(context.Background(), d.apiClient, sandbox.ID)
+	}
+
+	// OOM kills are counted per container, so only those after this point are of the sandbox
+	if sandbox.oomKills, err = oomKillCount(ctx, d.apiClient, sandbox.ID); err != nil {
+		log.Printf("Failed to count OOM kills of Docker container: %v", err)
+	}
+
+	// The cached workspace holds the files and the artifact
+	if hit {
+		if err := extractToContainer(ctx, d.apiClient, sandbox.ID, bytes.NewReader(snapshot)); err != nil {
+			log.Printf("Failed to restore cached artifact: %v", err)
+			discard()
+			return nil, CompileResult{}, err
+		}
+		sandbox.snapshot = snapshot
+		return sandbox, cached, nil
+	}
+
+	if err := copyFilesToContainer(ctx, d.apiClient, sandbox.ID, all); err != nil {
+		log.Printf("Failed to copy files to Docker container: %v", err)
+		discard()
+		return nil, CompileResult{}, err
+	}
+
+	compile := CompileResult{Success: true}
+	if spec.CompileCmd != nil {
+		result, err := d.compile(ctx, sandbox)
+		if err != nil {
+			log.Printf("Failed to run compiler: %v", err)
+			discard()
+			return nil, CompileResult{}, err
+		}
+		compile = newCompileResult(result)
+	}
+
+	// Every run starts from the workspace as the compiler left it
+	if compile.Success {
+		sandbox.snapshot, err = snapshotContainer(ctx, d.apiClient, sandbox.ID)
+		if err != nil {
+			log.Printf("Failed to snapshot Docker container workspace: %v", err)
+			discard()
+			return nil, CompileResult{}, err
+		}
+		storeArtifact(key, compile, sandbox.snapshot)
+	}
+
+	return sandbox, compile, nil
+}
+
+// compile runs the compile command in the container of the sandbox with the memory of a compiler, then gives the container back the memory of the sandbox.
+func (d *DockerRunner) compile(ctx context.Context, sandbox *Sandbox) (ExecutionResult, error) {
+	memory := sandbox.options.resources(sandbox.spec).Memory
+	if err := updateContainerMemory(ctx, d.apiClient, sandbox.ID, max(memory, CompileMemoryLimit)); err != nil {
+		return ExecutionResult{}, err
+	}
+
+	result, err := d.execute(ctx, sandbox, sandbox.spec.CompileCmd, strings.NewReader(""), DefaultCompileLimits, nil)
+	if err != nil {
+		return result, err
+	}
+
+	// The compiler has exited, what is left in memory is the workspace
+	if err := updateContainerMemory(ctx, d.apiClient, sandbox.ID, memory); err != nil {
+		return ExecutionResult{}, err
+	}
+	return result, nil
+}
+
+// Run executes the compiled artifact in the container under the limits.
+// Under memcheck the report comes over the stderr stream of the exec, and the stderr of the program from memcheckStderrFile.
+func (d *DockerRunner) Run(ctx context.Context, sandbox *Sandbox, stdin io.Reader, limits Limits) (ExecutionResult, error) {
+	if !sandbox.options.Memcheck {
+		result, err := d.execute(ctx, sandbox, sandbox.runCmd(), stdin, limits, nil)
+		if err != nil {
+			return result, err
+		}
+		return sandbox.withFindings(result), nil
+	}
+
+	cmd := append([]string{"sh", "-c", memcheckRedirectScript, memcheckStderrFile}, sandbox.runCmd()...)
+	report := newLimitedBuffer(maxMemcheckReportSize, nil)
+	result, err := d.execute(ctx, sandbox, cmd, stdin, limits, report)
+	if err != nil {
+		return result, err
+	}
+
+	if err := d.readMemcheckStderr(ctx, sandbox, limits, &result); err != nil {
+		log.Printf("Failed to read stderr of memcheck run: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+	memcheck := parseMemcheckReport([]byte(report.String()), sandbox.Files)
+	result.Memcheck = &memcheck
+	return sandbox.withFindings(result), nil
+}
+
+// readMemcheckStderr sets the stderr of the program of a memcheck run on its result, holding it to the output limit
+// the program could not be stopped at while it wrote to a file.
+func (d *DockerRunner) readMemcheckStderr(ctx context.Context, sandbox *Sandbox, limits Limits, result *ExecutionResult) error {
+	// The file is missing when the program was killed before the shell created it
+	script := `head -c "$0" "$1" 2>/dev/null || true`
+	stderr, err := execCommand(ctx, d.apiClient, sandbox.ID, []string{"sh", "-c", script, strconv.FormatInt(limits.OutputLimit+1, 10), memcheckStderrFile}, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+
+	result.Stderr = string(stderr)
+	if int64(len(stderr)) > limits.OutputLimit {
+		result.Stderr = result.Stderr[:limits.OutputLimit]
+		result.OutputTruncated = true
+		if result.Verdict == VerdictOK || result.Verdict == VerdictRuntimeError {
+			result.Verdict = VerdictOutputLimitExceeded
+		}
+	}
+	return nil
+}
+
+// AddFiles copies the files into the workspace of the container.
+func (d *DockerRunner) AddFiles(ctx context.Context, sandbox *Sandbox, files []File) error {
+	if err := validateFiles(files); err != nil {
+		return err
+	}
+
+	if err := copyFilesToContainer(ctx, d.apiClient, sandbox.ID, files); err != nil {
+		log.Printf("Failed to copy files to Docker container: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Reset kills the processes left by the previous run and restores the workspace from the snapshot taken after compilation.
+func (d *DockerRunner) Reset(ctx context.Context, sandbox *Sandbox) error {
+	if err := resetContainer(ctx, d.apiClient, sandbox.ID); err != nil {
+		log.Printf("Failed to reset Docker container: %v", err)
+		return err
+	}
+
+	if err := extractToContainer(ctx, d.apiClient, sandbox.ID, bytes.NewReader(sandbox.snapshot)); err != nil {
+		log.Printf("Failed to restore Docker container workspace: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Cleanup returns the container to the warm pool after resetting it, or stops and removes it.
+func (d *DockerRunner) Cleanup(sandbox *Sandbox) error {
+	if warm := d.warmPool(); warm != nil && sandbox.options.pooled(sandbox.spec) && warm.reset(context.Background(), sandbox) && d.recycle(warm, sandbox) {
+		return nil
+	}
+	d.deactivate(sandbox.ID)
+
+	// The reaper may have removed the container of a sandbox that outlived its deadline
+	if err := removeContainer(context.Background(), d.apiClient, sandbox.ID); err != nil && !client.IsErrNotFound(err) {
+		log.Printf("Failed to remove Docker container: %v", err)
+		return err
+	}
+	return nil
+}
+
+// StartWarmPool keeps the given number of started idle containers per language for new sandboxes until the context is done.
+// Idle containers are health checked periodically and replaced when they stopped.
+func (d *DockerRunner) StartWarmPool(ctx context.Context, sizes map[Language]int) {
+	warm := newWarmPool(d.apiClient, sizes, d.sandboxLabels)
+
+	d.mu.Lock()
+	d.warm = warm
+	d.mu.Unlock()
+
+	go warm.monitor(ctx)
+}
+
+// WarmPoolStats returns the state of the warm pool per language, or nil when it is disabled.
+func (d *DockerRunner) WarmPoolStats() map[Language]WarmPoolStats {
+	warm := d.warmPool()
+	if warm == nil {
+		return nil
+	}
+	return warm.snapshot()
+}
+
+// warmPool returns the warm pool, or nil when it is disabled.
+func (d *DockerRunner) warmPool() *warmPool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.warm
+}
+
+// activate records that the container hosts a sandbox, which the reaper leaves alone for the lifetime of the sandbox.
+func (d *DockerRunner) activate(containerID string, lifetime time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active[containerID] = time.Now().Add(lifetime)
+}
+
+// takeWarm takes an idle container of the language that outlives a sandbox of the lifetime from the warm pool and activates it,
+// in one step so the reaper never finds it neither idle nor active.
+func (d *DockerRunner) takeWarm(warm *warmPool, language Language, lifetime time.Duration) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deadline := time.Now().Add(lifetime)
+	containerID, ok := warm.take(language, deadline)
+	if ok {
+		d.active[containerID] = deadline
+	}
+	return containerID, ok
+}
+
+// recycle returns the reset container of the sandbox to the warm pool and deactivates it in one step, reporting false when the pool is full.
+func (d *DockerRunner) recycle(warm *warmPool, sandbox *Sandbox) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !warm.recycle(sandbox.Language, sandbox.ID) {
+		return false
+	}
+	delete(d.active, sandbox.ID)
+	return true
+}
+
+// deactivate records that the container no longer hosts a sandbox.
+func (d *DockerRunner) deactivate(containerID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.active, containerID)
+}
+
+// sandboxLabels returns the labels of a new container of this runner, which other runners reap after the deadline.
+func (d *DockerRunner) sandboxLabels(deadline time.Time) map[string]string {
+	return map[string]string{
+		sandboxLabel:  "true",
+		instanceLabel: d.instance,
+		deadlineLabel: strconv.FormatInt(deadline.Unix(), 10),
+	}
+}
+
+// execute runs the command in the container of the sandbox with stdin attached, killing it once the wall time is up or the context is done, and returns the result.
+// When report is set the stderr stream carries a report of the command rather than output of the program, and goes there instead of the result.
+func (d *DockerRunner) execute(ctx context.Context, sandbox *Sandbox, cmd []string, stdin io.Reader, limits Limits, report *limitedBuffer) (ExecutionResult, error) {
+	containerID := sandbox.ID
+
+	cpuBefore, err := getContainerCPUTime(ctx, d.apiClient, containerID)
+	if err != nil {
+		log.Printf("Failed to get Docker container stats: %v", err)
+		return ExecutionResult{}, err
+	}
+
+	execID, err := createExec(ctx, d.apiClient, containerID, rlimitCmd(cmd, limits), sandbox.spec.Env)
+	if err != nil {
+		log.Printf("Failed to create Docker exec: %v", err)
+		return ExecutionResult{}, err
+	}
+
+	statsCtx, stopStats := context.WithCancel(ctx)
+	defer stopStats()
+	usageCh := watchContainerUsage(statsCtx, d.apiClient, containerID)
+
+	start := time.Now()
+	hijacked, err := attachExec(ctx, d.apiClient, execID, stdin)
+	if err != nil {
+		log.Printf("Failed to attach to Docker exec: %v", err)
+		return ExecutionResult{}, err
+	}
+	defer hijacked.Close()
+
+	output, err := getExecOutput(ctx, d.apiClient, containerID, hijacked, limits, sandbox.stdout, report)
+	wallTime := time.Since(start)
+	stopStats()
+	usage := <-usageCh
+	if err != nil {
+		log.Printf("Failed to get Docker exec output: %v", err)
+		return ExecutionResult{}, err
+	}
+
+	inspect, err := waitExec(ctx, d.apiClient, execID)
+	if err != nil {
+		log.Printf("Failed to inspect Docker exec: %v", err)
+		return ExecutionResult{}, err
+	}
+
+	cpuAfter, err := getContainerCPUTime(ctx, d.apiClient, containerID)
+	if err != nil {
+		log.Printf("Failed to get Docker container stats: %v", err)
+		return ExecutionResult{}, err
+	}
+
+	result := ExecutionResult{
+		Stdout:          output.stdout,
+		Stderr:          output.stderr,
+		ExitCode:        inspect.ExitCode,
+		Signal:          signalFromExitCode(inspect.ExitCode),
+		WallTime:        wallTime,
+		CPUTime:         cpuAfter - cpuBefore,
+		PeakMemory:      usage.peakMemory,
+		OutputTruncated: output.truncated,
+	}
+	// A program killed by SIGKILL that we did not kill ourselves may have been killed by the kernel OOM killer
+	if !output.timedOut && !output.truncated && result.ExitCode == exitCodeSignalBase+9 {
+		result.OOMKilled, err = d.oomKilled(ctx, sandbox)
+		if err != nil {
+			log.Printf("Failed to inspect Docker container: %v", err)
+			return ExecutionResult{}, err
+		}
+	}
+	timedOut := output.timedOut || result.CPUTime >= limits.CPUTime || result.ExitCode == exitCodeCPUTimeExceeded
+	result.Verdict = newVerdict(result, timedOut)
+
+	return result, nil
+}
+
+// oomKilled reports whether the kernel OOM killer killed a process in the container of the sandbox since the last time it was asked.
+// Without the OOM kill counter of the cgroup it falls back to the OOM flag of the container, which stays set once any process was killed.
+func (d *DockerRunner) oomKilled(ctx context.Context, sandbox *Sandbox) (bool, error) {
+	count, err := oomKillCount(ctx, d.apiClient, sandbox.ID)
+	if err != nil {
+		inspect, err := d.apiClient.ContainerInspect(ctx, sandbox.ID)
+		if err != nil {
+			return false, err
+		}
+		return inspect.State != nil && inspect.State.OOMKilled, nil
+	}
+
+	killed := count > sandbox.oomKills
+	sandbox.oomKills = count
+	return killed, nil
+}
+
+// oomKillCountCmd prints the memory events of the cgroup of the container, from cgroup v2 or else from cgroup v1.
+var oomKillCountCmd = []string{"sh", "-c", "cat /sys/fs/cgroup/memory.events 2>/dev/null || cat /sys/fs/cgroup/memory/memory.oom_control"}
+
+// oomKillCount returns how many processes the kernel OOM killer killed in the Docker container with the specified ID since it started.
+func oomKillCount(ctx context.Context, apiClient *client.Client, containerID string) (int64, error) {
+	output, err := execCommand(ctx, apiClient, containerID, oomKillCountCmd, strings.NewReader(""))
+	if err != nil {
+		return 0, err
+	}
+	return parseOOMKillCount(string(output))
+}
+
+// parseOOMKillCount returns the oom_kill counter of memory.events or memory.oom_control.
+func parseOOMKillCount(events string) (int64, error) {
+	for _, line := range strings.Split(events, "\n") {
+		if count, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			return strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+		}
+	}
+	return 0, errors.New("the cgroup of the container does not count OOM kills")
+}
+
+// createNewAPIClient creates a new Docker API client.
+func createNewAPIClient() (*client.Client, error) {
+	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+}
+
+// createContainer creates a new Docker container with the specified image, command, name, resources and labels.
+func createContainer(ctx context.Context, apiClient *client.Client, containerImage string, cmd []string, containerName string, resources Resources, labels map[string]string) (container.CreateResponse, error) {
+	pidsLimit := resources.Processes
+
+	return apiClient.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image:           containerImage,
+			Cmd:             cmd,
+			WorkingDir:      WorkspaceDir,
+			NetworkDisabled: true,
+			User:            "nobody", // Run as non-root user
+			Labels:          labels,
+		},
+		&container.HostConfig{
+			Resources: container.Resources{
+				Memory:     resources.Memory,
+				MemorySwap: resources.Memory, // No swap
+				CPUPeriod:  CPUPeriod,
+				CPUQuota:   resources.cpuQuota(),
+				PidsLimit:  &pidsLimit,
+			},
+			ShmSize:        ScratchSize,
+			NetworkMode:    "none", // Disable networking
+			ReadonlyRootfs: true,   // Make filesystem read-only
+			Tmpfs: map[string]string{
+				// Workspace for the files and the artifact, owned by the sandbox user
+				WorkspaceDir: fmt.Sprintf("rw,exec,nosuid,nodev,size=%d,mode=0755,uid=%d,gid=%d", WorkspaceSize, sandboxUserID, sandboxUserID),
+				// Temporary files of the compiler and the program
+				ScratchDir: fmt.Sprintf("rw,noexec,nosuid,nodev,size=%d,mode=1777", ScratchSize),
+			},
+			SecurityOpt: []string{
+				"no-new-privileges", // Prevent escalation of privileges
+			},
+		},
+		nil,
+		nil,
+		containerName,
+	)
+}
+
+// updateContainerMemory sets the memory of the Docker container with the specified ID, without swap.
+func updateContainerMemory(ctx context.Context, apiClient *client.Client, containerID string, memory int64) error {
+	_, err := apiClient.ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		Resources: container.Resources{
+			Memory:     memory,
+			MemorySwap: memory,
+		},
+	})
+	return err
+}
+
+// startSandboxContainer creates and starts an idle container with the resources and the labels for sandboxes of the language.
+func startSandboxContainer(ctx context.Context, apiClient *client.Client, spec LanguageSpec, resources Resources, labels map[string]string) (string, error) {
+	resp, err := createContainer(ctx, apiClient, spec.Image, idleCmd, string(spec.ID)+"-code-runner-"+NewID(), resources, labels)
+	if err != nil {
+		return "", err
+	}
+
+	if err := startContainer(ctx, apiClient, resp.ID); err != nil {
+		removeContainer(ctx, apiClient, resp.ID)
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// startContainer starts the Docker container with the specified ID.
+func startContainer(ctx context.Context, apiClient *client.Client, containerID string) error {
+	return apiClient.ContainerStart(ctx, containerID, container.StartOptions{})
+}
+
+// copyFilesToContainer copies the files as a tar archive into the workspace of the Docker container with the specified ID.
+// The archive is extracted by tar in the container because the Docker archive API cannot write to a tmpfs under a read-only root filesystem.
+func copyFilesToContainer(ctx context.Context, apiClient *client.Client, containerID string, files []File) error {
+	archive, err := archiveFiles(files)
+	if err != nil {
+		return err
+	}
+	return extractToContainer(ctx, apiClient, containerID, archive)
+}
+
+// extractToContainer extracts the tar archive into the workspace of the Docker container with the specified ID.
+func extractToContainer(ctx context.Context, apiClient *client.Client, containerID string, archive io.Reader) error {
+	_, err := execCommand(ctx, apiClient, containerID, []string{"tar", "-x", "-f", "-", "-C", WorkspaceDir}, archive)
+	return err
+}
+
+// snapshotContainer returns a tar archive of the workspace of the Docker container with the specified ID.
+func snapshotContainer(ctx context.Context, apiClient *client.Client, containerID string) ([]byte, error) {
+	return execCommand(ctx, apiClient, containerID, []string{"tar", "-c", "-f", "-", "-C", WorkspaceDir, "."}, strings.NewReader(""))
+}
+
+// execCommand runs a command of the engine as the sandbox user in the Docker container with the specified ID and returns its stdout.
+// A non-zero exit status is an error carrying the stderr of the command.
+func execCommand(ctx context.Context, apiClient *client.Client, containerID string, cmd []string, stdin io.Reader) ([]byte, error) {
+	execID, err := createExec(ctx, apiClient, containerID, cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hijacked, err := attachExec(ctx, apiClient, execID, stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer hijacked.Close()
+
+	var stdout bytes.Buffer
+	var stderr strings.Builder
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, hijacked.Reader); err != nil {
+		return nil, err
+	}
+
+	inspect, err := waitExec(ctx, apiClient, execID)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.ExitCode != 0 {
+		return nil, fmt.Errorf("%s exited with status %d: %s", cmd[0], inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// createExec creates a command to run as the sandbox user with the extra environment in the Docker container with the specified ID.
+func createExec(ctx context.Context, apiClient *client.Client, containerID string, cmd []string, env []string) (string, error) {
+	resp, err := apiClient.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		User:         "nobody",
+		WorkingDir:   WorkspaceDir,
+		Env:          env,
+		Cmd:          cmd,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// attachExec starts the exec with the specified ID and streams the input into its stdin.
+func attachExec(ctx context.Context, apiClient *client.Client, execID string, stdin io.Reader) (types.HijackedResponse, error) {
+	hijacked, err := apiClient.ContainerExecAttach(ctx, execID, types.ExecStartCheck{})
+	if err != nil {
+		return hijacked, err
+	}
+
+	go func() {
+		if _, err := io.Copy(hijacked.Conn, stdin); err != nil {
+			log.Printf("Failed to write stdin to Docker exec: %v", err)
+		}
+		hijacked.CloseWrite()
+	}()
+
+	return hijacked, nil
+}
+
+// execOutput is the output captured from an exec and why capturing it stopped early, if it did.
+type execOutput struct {
+	stdout    string
+	stderr    string
+	timedOut  bool // Killed for running out of wall time
+	truncated bool // Killed for writing more than the output limit
+}
+
+// getExecOutput returns the stdout and stderr of an attached exec, capped at the output limit, copying stdout to the writer as it arrives if set.
+// With a report buffer the stderr stream is captured there instead. Every sandbox process is killed as soon as the output limit is crossed, the wall time is up or the context is done.
+func getExecOutput(ctx context.Context, apiClient *client.Client, containerID string, hijacked types.HijackedResponse, limits Limits, stdoutCopy io.Writer, report *limitedBuffer) (execOutput, error) {
+	stdout := newLimitedBuffer(limits.OutputLimit, nil)
+	stderr := newLimitedBuffer(limits.OutputLimit, nil)
+
+	var stderrStream io.Writer = stderr
+	if report != nil {
+		// A report longer than its buffer is cut rather than stopping the program
+		stderrStream = &copyingWriter{w: report}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(captureOutput(stdout, stdoutCopy), stderrStream, hijacked.Reader)
+		done <- err
+	}()
+
+	timer := time.NewTimer(limits.WallTime)
+	defer timer.Stop()
+
+	output := execOutput{}
+	select {
+	case err := <-done:
+		if errors.Is(err, errOutputLimitExceeded) {
+			output.truncated = true
+			if err := killSandboxProcesses(ctx, apiClient, containerID); err != nil {
+				return output, err
+			}
+		} else if err != nil {
+			return output, err
+		}
+	case <-ctx.Done():
+		// The context can no longer be used to reach the container
+		if err := killSandboxProcesses(context.Background(), apiClient, containerID); err != nil {
+			return output, err
+		}
+		return output, ctx.Err()
+	case <-timer.C:
+		output.timedOut = true
+		if err := killSandboxProcesses(ctx, apiClient, containerID); err != nil {
+			return output, err
+		}
+		// The stream ends once the killed processes close their end of it
+		if err := <-done; errors.Is(err, errOutputLimitExceeded) {
+			output.truncated = true
+		} else if err != nil {
+			return output, err
+		}
+	}
+
+	output.stdout = stdout.String()
+	output.stderr = stderr.String()
+	return output, nil
+}
+
+// killSandboxProcesses kills every process of the sandbox user in the Docker container with the specified ID except the idle one.
+func killSandboxProcesses(ctx context.Context, apiClient *client.Client, containerID string) error {
+	// kill -1 signals every process the user may signal except the caller and the container init
+	execID, err := createExec(ctx, apiClient, containerID, []string{"kill", "-KILL", "-1"}, nil)
+	if err != nil {
+		return err
+	}
+	if err := apiClient.ContainerExecStart(ctx, execID, types.ExecStartCheck{}); err != nil {
+		return err
+	}
+	_, err = waitExec(ctx, apiClient, execID)
+	return err
+}
+
+// resetContainer kills every sandbox process and empties the workspace, the scratch space and the shared memory of the Docker container
+// with the specified ID, so the next sandbox starts from a clean container.
+func resetContainer(ctx context.Context, apiClient *client.Client, containerID string) error {
+	if err := killSandboxProcesses(ctx, apiClient, containerID); err != nil {
+		return err
+	}
+
+	_, err := execCommand(ctx, apiClient, containerID, []string{"find", WorkspaceDir, ScratchDir, SharedMemoryDir, "-mindepth", "1", "-delete"}, strings.NewReader(""))
+	return err
+}
+
+// waitExec waits for the exec with the specified ID to exit and returns its final state.
+func waitExec(ctx context.Context, apiClient *client.Client, execID string) (types.ContainerExecInspect, error) {
+	for {
+		inspect, err := apiClient.ContainerExecInspect(ctx, execID)
+		if err != nil || !inspect.Running {
+			return inspect, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return inspect, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// getContainerCPUTime returns the CPU time consumed by the Docker container with the specified ID so far.
+func getContainerCPUTime(ctx context.Context, apiClient *client.Client, containerID string) (time.Duration, error) {
+	stats, err := apiClient.ContainerStatsOneShot(ctx, containerID)
+	if err != nil {
+		return 0, err
+	}
+	defer stats.Body.Close()
+
+	var sample types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&sample); err != nil {
+		return 0, err
+	}
+	return time.Duration(sample.CPUStats.CPUUsage.TotalUsage), nil
+}
+
+// containerUsage is the resource usage of a container sampled from its stats.
+type containerUsage struct {
+	peakMemory int64
+}
+
+// watchContainerUsage samples the stats of the Docker container with the specified ID until the context is done.
+// The channel receives the peak memory seen.
+func watchContainerUsage(ctx context.Context, apiClient *client.Client, containerID string) <-chan containerUsage {
+	usageCh := make(chan containerUsage, 1)
+
+	go func() {
+		usage := containerUsage{}
+		defer func() { usageCh <- usage }()
+
+		stats, err := apiClient.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			return
+		}
+		defer stats.Body.Close()
+
+		decoder := json.NewDecoder(stats.Body)
+		for {
+			var sample types.StatsJSON
+			if err := decoder.Decode(&sample); err != nil {
+				return
+			}
+			memory := int64(max(sample.MemoryStats.Usage, sample.MemoryStats.MaxUsage))
+			if memory > usage.peakMemory {
+				usage.peakMemory = memory
+			}
+		}
+	}()
+
+	return usageCh
+}
+
+// removeContainer removes the Docker container with the specified ID.
+func removeContainer(ctx context.Context, apiClient *client.Client, containerID string) error {
+	return apiClient.ContainerRemove(ctx, containerID, container.RemoveOptions{
+		Force: true, // The container is idling until it is removed
+	})
+}
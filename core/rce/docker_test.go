@@ -0,0 +1,189 @@
+package rce
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// newTestDockerRunner returns a Docker runner with the image of the language present, skipping the test when there is none.
+func newTestDockerRunner(t *testing.T, language Language) *DockerRunner {
+	t.Helper()
+
+	runner, err := NewDockerRunner()
+	if err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := runner.apiClient.Ping(ctx); err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present, err := imageExists(ctx, runner.apiClient, spec.Image); err != nil || !present {
+		t.Skipf("image %s is not present", spec.Image)
+	}
+	return runner
+}
+
+func TestDockerResetClearsSharedMemory(t *testing.T) {
+	runner := newTestDockerRunner(t, PYTHON)
+	ctx := context.Background()
+
+	// Every run reports whether a previous one left its file in shared memory
+	program := "import os\nprint(os.path.exists('/dev/shm/leftover'))\nopen('/dev/shm/leftover', 'w').write('secret')\n"
+	sandbox, compile, err := runner.Compile(ctx, program, PYTHON, nil, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Cleanup(sandbox)
+	if !compile.Success {
+		t.Fatalf("compilation failed: %s", compile.Diagnostics)
+	}
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			if err := runner.Reset(ctx, sandbox); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result, err := runner.Run(ctx, sandbox, strings.NewReader(""), DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != VerdictOK || result.Stdout != "False\n" {
+			t.Fatalf("run %d: verdict %s, stdout %q, stderr %q", i, result.Verdict, result.Stdout, result.Stderr)
+		}
+	}
+}
+
+func TestDockerRunJob(t *testing.T) {
+	runner := newTestDockerRunner(t, PYTHON)
+
+	// Each input selects how the program ends
+	program := `import sys
+mode = input()
+if mode == "ok":
+    print("ok")
+elif mode == "error":
+    sys.exit(3)
+elif mode == "loop":
+    while True:
+        pass
+elif mode == "output":
+    print("a" * (2 << 20))
+`
+	limits := LimitsFor(PYTHON)
+	limits.CPUTime, limits.WallTime, limits.OutputLimit = time.Second, 2*time.Second, 1<<20
+
+	result, err := RunJobWith(context.Background(), runner, Job{
+		Program:  program,
+		Language: PYTHON,
+		Limits:   limits,
+		Tests: []TestCase{
+			{Input: StringInput("ok\n"), Expected: "ok"},
+			{Input: StringInput("ok\n"), Expected: "no"},
+			{Input: StringInput("error\n")},
+			{Input: StringInput("loop\n")},
+			{Input: StringInput("output\n")},
+		},
+		Checker: &CheckerSpec{Kind: CheckerExact},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Verdict{VerdictAccepted, VerdictWrongAnswer, VerdictRuntimeError, VerdictTimeLimitExceeded, VerdictOutputLimitExceeded}
+	if got := verdicts(result); !reflect.DeepEqual(got, want) {
+		t.Fatalf("verdicts %v, want %v", got, want)
+	}
+	if exitCode := result.Results[2].ExitCode; exitCode != 3 {
+		t.Fatalf("exit code %d, want 3", exitCode)
+	}
+}
+
+func TestDockerWarmPool(t *testing.T) {
+	runner := newTestDockerRunner(t, PYTHON)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner.StartWarmPool(ctx, map[Language]int{PYTHON: 1})
+	waitForWarmContainers(t, runner, 1)
+
+	sandbox, compile, err := runner.Compile(ctx, "print('warm')", PYTHON, nil, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compile.Success {
+		t.Fatalf("compilation failed: %s", compile.Diagnostics)
+	}
+	result, err := runner.Run(ctx, sandbox, strings.NewReader(""), DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Verdict != VerdictOK || result.Stdout != "warm\n" {
+		t.Fatalf("verdict %s, stdout %q, stderr %q", result.Verdict, result.Stdout, result.Stderr)
+	}
+	if err := runner.Cleanup(sandbox); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sandbox took the warm container, which went back to the pool once it was reset
+	stats := runner.WarmPoolStats()[PYTHON]
+	if stats.Hits != 1 || stats.Recycled != 1 || stats.Idle != 1 {
+		t.Fatalf("warm pool stats %+v, want a hit and a recycled idle container", stats)
+	}
+}
+
+// waitForWarmContainers waits until the warm pool of Python has the given number of idle containers.
+func waitForWarmContainers(t *testing.T, runner *DockerRunner, idle int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Minute)
+	for runner.WarmPoolStats()[PYTHON].Idle != idle {
+		if time.Now().After(deadline) {
+			t.Fatalf("warm pool stats %+v, want %d idle containers", runner.WarmPoolStats()[PYTHON], idle)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestDockerReaper(t *testing.T) {
+	runner := newTestDockerRunner(t, PYTHON)
+	ctx := context.Background()
+
+	spec, err := lookupLanguage(PYTHON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A container left behind by another runner, past its deadline
+	labels := map[string]string{
+		sandboxLabel:  "true",
+		instanceLabel: "crashed",
+		deadlineLabel: strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10),
+	}
+	containerID, err := startSandboxContainer(ctx, runner.apiClient, spec, spec.DefaultResources(), labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeContainer(ctx, runner.apiClient, containerID)
+
+	runner.reap(ctx)
+
+	if _, err := runner.apiClient.ContainerInspect(ctx, containerID); !client.IsErrNotFound(err) {
+		t.Fatalf("ContainerInspect() = %v, want the container to be reaped", err)
+	}
+	if stats := runner.ReaperStats(); stats.Sweeps != 1 || stats.Reaped < 1 {
+		t.Fatalf("reaper stats %+v, want a sweep reaping the container", stats)
+	}
+}
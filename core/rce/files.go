@@ -0,0 +1,182 @@
+package rce
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	WorkspaceDir  = "/workspace" // Working directory of the program inside the sandbox
+	ScratchDir    = "/tmp"       // Scratch space for temporary files inside the sandbox, programs cannot be executed from it
+	WorkspaceSize = 64 << 20     // 64MB for the files and the compiled artifact
+	ScratchSize   = 16 << 20     // 16MB for temporary files
+
+	SharedMemoryDir = "/dev/shm" // POSIX shared memory of the container, as big as the scratch space
+)
+
+// File is a file placed in the working directory of the sandbox before the program runs.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// validateFiles checks that every file name is a plain name inside the working directory.
+func validateFiles(files []File) error {
+	for _, file := range files {
+		if file.Name == "" || file.Name == "." || file.Name == ".." || filepath.Base(file.Name) != file.Name {
+			return fmt.Errorf("invalid file name: %q", file.Name)
+		}
+	}
+	return nil
+}
+
+// archiveFiles returns a tar archive containing the files, owned by the sandbox user.
+func archiveFiles(files []File) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	for _, file := range files {
+		header := &tar.Header{
+			Name: file.Name,
+			Mode: 0644,
+			Size: int64(len(file.Content)),
+			Uid:  sandboxUserID,
+			Gid:  sandboxUserID,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// archiveDir returns a tar archive of the regular files and directories in the directory.
+func archiveDir(dir string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil // Links and devices are never restored
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// restoreDir empties the directory and extracts the archive made by archiveDir into it.
+func restoreDir(dir string, archive []byte) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		mode := header.FileInfo().Mode().Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(path, mode); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFiles writes the files into the directory, replacing existing entries instead of writing through them
+// so a symlink left in the directory cannot redirect the write.
+func writeFiles(dir string, files []File) error {
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(file.Content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
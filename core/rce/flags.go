@@ -0,0 +1,105 @@
+package rce
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CompilerFlags are the compile options a question builds its submissions with, on top of the compile command of the language.
+// Every option must be allowed by the flags spec of the language.
+type CompilerFlags struct {
+	Standard     string   `json:"standard,omitempty"`     // Language standard: c99, c11, c++17, ... or the Java release: 8, 17, ...
+	Optimization string   `json:"optimization,omitempty"` // Optimization level passed as -O<level>: 0, 1, 2, 3 or s
+	Libraries    []string `json:"libraries,omitempty"`    // Libraries linked with -l<library>: m, pthread, ...
+	Werror       bool     `json:"werror,omitempty"`       // Enable the common warnings and fail compilation on any of them
+	Defines      []string `json:"defines,omitempty"`      // Macros defined with -D: NAME or NAME=value
+}
+
+// FlagsSpec is the allowlist of compiler flags of a language and how the standard is selected.
+type FlagsSpec struct {
+	Standards    []string `yaml:"standards"`    // Allowed standards
+	StandardArgs []string `yaml:"standardArgs"` // Arguments selecting the standard, with {} replaced by it
+	Optimization bool     `yaml:"optimization"` // Optimization levels are allowed
+	Libraries    []string `yaml:"libraries"`    // Allowed libraries
+	Werror       bool     `yaml:"werror"`       // Failing on warnings is allowed
+	Defines      bool     `yaml:"defines"`      // Defines are allowed
+}
+
+// maxDefines caps the macros a question can define.
+const maxDefines = 16
+
+var (
+	optimizationLevels = map[string]bool{"0": true, "1": true, "2": true, "3": true, "s": true}
+	// NAME or NAME=value, values cannot contain spaces or quotes
+	definePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(=[A-Za-z0-9_.+\-]*)?$`)
+)
+
+// Validate checks that the language accepts every flag.
+func (f CompilerFlags) Validate(language Language) error {
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		return err
+	}
+	return f.validate(spec)
+}
+
+// validate checks the flags against the allowlist of the language.
+func (f CompilerFlags) validate(spec LanguageSpec) error {
+	allowed := spec.Flags
+	if allowed == nil {
+		allowed = &FlagsSpec{}
+	}
+
+	switch {
+	case f.Standard != "" && !slices.Contains(allowed.Standards, f.Standard):
+		return fmt.Errorf("standard %q is not allowed for %s", f.Standard, spec.ID)
+	case f.Optimization != "" && (!allowed.Optimization || !optimizationLevels[f.Optimization]):
+		return fmt.Errorf("optimization level %q is not allowed for %s", f.Optimization, spec.ID)
+	case f.Werror && !allowed.Werror:
+		return fmt.Errorf("failing on warnings is not supported for %s", spec.ID)
+	case len(f.Defines) > 0 && !allowed.Defines:
+		return fmt.Errorf("defines are not supported for %s", spec.ID)
+	case len(f.Defines) > maxDefines:
+		return fmt.Errorf("at most %d defines are allowed", maxDefines)
+	}
+
+	for _, library := range f.Libraries {
+		if !slices.Contains(allowed.Libraries, library) {
+			return fmt.Errorf("library %q is not allowed for %s", library, spec.ID)
+		}
+	}
+	for _, define := range f.Defines {
+		if !definePattern.MatchString(define) {
+			return fmt.Errorf("invalid define: %q", define)
+		}
+	}
+	return nil
+}
+
+// apply returns the compile command with the flags: options right after the compiler, libraries last so the linker sees them after the sources.
+func (f CompilerFlags) apply(spec LanguageSpec, cmd []string) []string {
+	var options []string
+	if f.Standard != "" {
+		for _, arg := range spec.Flags.StandardArgs {
+			options = append(options, strings.ReplaceAll(arg, "{}", f.Standard))
+		}
+	}
+	if f.Optimization != "" {
+		options = append(options, "-O"+f.Optimization)
+	}
+	if f.Werror {
+		options = append(options, "-Wall", "-Werror")
+	}
+	for _, define := range f.Defines {
+		options = append(options, "-D"+define)
+	}
+
+	result := append([]string{cmd[0]}, options...)
+	result = append(result, cmd[1:]...)
+	for _, library := range f.Libraries {
+		result = append(result, "-l"+library)
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package rce
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompilerFlagsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		language Language
+		flags    CompilerFlags
+		valid    bool
+	}{
+		{"none", PYTHON, CompilerFlags{}, true},
+		{"c standard", C, CompilerFlags{Standard: "c11"}, true},
+		{"c++ standard for c", C, CompilerFlags{Standard: "c++17"}, false},
+		{"java release", JAVA, CompilerFlags{Standard: "17"}, true},
+		{"optimization", CPP, CompilerFlags{Optimization: "2"}, true},
+		{"unknown optimization level", CPP, CompilerFlags{Optimization: "fast"}, false},
+		{"optimization for java", JAVA, CompilerFlags{Optimization: "2"}, false},
+		{"allowed library", C, CompilerFlags{Libraries: []string{"m", "pthread"}}, true},
+		{"other library", C, CompilerFlags{Libraries: []string{"ssl"}}, false},
+		{"werror", CPP, CompilerFlags{Werror: true}, true},
+		{"werror for python", PYTHON, CompilerFlags{Werror: true}, false},
+		{"defines", C, CompilerFlags{Defines: []string{"DEBUG", "N=10", "EPS=1e-9"}}, true},
+		{"define injecting an option", C, CompilerFlags{Defines: []string{"X -o /tmp/x"}}, false},
+		{"define with quotes", C, CompilerFlags{Defines: []string{`S="a"`}}, false},
+		{"too many defines", C, CompilerFlags{Defines: make([]string, maxDefines+1)}, false},
+		{"unknown language", "cobol", CompilerFlags{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.flags.Validate(test.language); (err == nil) != test.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestCompilerFlagsApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		language Language
+		flags    CompilerFlags
+		want     []string
+	}{
+		{"none", C, CompilerFlags{}, []string{"gcc", "main.c", "-o", "main"}},
+		{
+			"all",
+			C,
+			CompilerFlags{Standard: "c99", Optimization: "2", Werror: true, Defines: []string{"N=1"}, Libraries: []string{"m"}},
+			[]string{"gcc", "-std=c99", "-O2", "-Wall", "-Werror", "-DN=1", "main.c", "-o", "main", "-lm"},
+		},
+		{"java release", JAVA, CompilerFlags{Standard: "11"}, []string{"javac", "--release", "11", "Main.java"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := lookupLanguage(test.language)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := test.flags.apply(spec, spec.CompileCmd); !slices.Equal(got, test.want) {
+				t.Fatalf("apply() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package rce
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ValueType is the type of a parameter or of the return value of a function judged through a harness.
+// Arrays are written as the element type followed by [], e.g. int[].
+type ValueType string
+
+const (
+	TypeInt    ValueType = "int"
+	TypeLong   ValueType = "long" // 64 bits
+	TypeDouble ValueType = "double"
+	TypeBool   ValueType = "bool"
+	TypeChar   ValueType = "char"
+	TypeString ValueType = "string"
+	TypeVoid   ValueType = "void" // Return type only, nothing is printed
+)
+
+// Variable is a parameter of a function judged through a harness.
+type Variable struct {
+	Name string    `json:"name"`
+	Type ValueType `json:"type"` // String when empty
+}
+
+// FunctionSpec is the function a question asks for.
+//
+// The harness reads one line of stdin per parameter, in order:
+//   - int, long, double: the number
+//   - bool: true or false (1 or 0)
+//   - char: the first character of the line
+//   - string: the whole line
+//   - arrays: the number of elements followed by the elements, separated by whitespace
+//
+// and prints the return value on one line: doubles with 6 decimals, bools as true or false
+// and arrays as their elements separated by single spaces.
+//
+// C and C++ submissions define a free function; C arrays are passed as a pointer followed by an int length
+// and cannot be returned, and C strings are returned in memory allocated with malloc, which the harness frees. Java submissions define the method in a class named Solution. Python submissions
+// define a top level function or a method of a class named Solution.
+type FunctionSpec struct {
+	Name       string     `json:"name"`
+	Parameters []Variable `json:"parameters"`
+	ReturnType ValueType  `json:"returnType"` // Void when empty
+}
+
+// Harness is a submission wrapped with the driver that calls its function.
+type Harness struct {
+	Program    string
+	LineOffset int // Lines the harness puts before the submission
+}
+
+// harnessGenerator wraps the code of a submission with a driver calling the function.
+type harnessGenerator func(code string, fn FunctionSpec) (Harness, error)
+
+// harnessGenerators are the generators a language can select with its harness field.
+var harnessGenerators = map[string]harnessGenerator{
+	"c":      cHarness,
+	"cpp":    cppHarness,
+	"java":   javaHarness,
+	"python": pythonHarness,
+}
+
+// identifierPattern matches names that are valid identifiers in every supported language.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// scalarTypes are the types an array can hold.
+var scalarTypes = map[ValueType]bool{
+	TypeInt:    true,
+	TypeLong:   true,
+	TypeDouble: true,
+	TypeBool:   true,
+	TypeChar:   true,
+	TypeString: true,
+}
+
+// IsArray reports whether the type is an array.
+func (t ValueType) IsArray() bool {
+	return strings.HasSuffix(string(t), "[]")
+}
+
+// Elem returns the type of the elements of an array type.
+func (t ValueType) Elem() ValueType {
+	return ValueType(strings.TrimSuffix(string(t), "[]"))
+}
+
+// validate checks that the type is a scalar or an array of scalars.
+func (t ValueType) validate() error {
+	if !scalarTypes[t] && !(t.IsArray() && scalarTypes[t.Elem()]) {
+		return fmt.Errorf("unsupported type: %s", t)
+	}
+	return nil
+}
+
+// withDefaults returns the spec with unset types filled in.
+func (f FunctionSpec) withDefaults() FunctionSpec {
+	parameters := make([]Variable, len(f.Parameters))
+	for i, parameter := range f.Parameters {
+		if parameter.Type == "" {
+			parameter.Type = TypeString
+		}
+		parameters[i] = parameter
+	}
+	f.Parameters = parameters
+
+	if f.ReturnType == "" {
+		f.ReturnType = TypeVoid
+	}
+	return f
+}
+
+// Validate checks that the names are identifiers and every type is supported.
+// Names end up in generated code, so nothing else is accepted.
+func (f FunctionSpec) Validate() error {
+	f = f.withDefaults()
+
+	if !identifierPattern.MatchString(f.Name) {
+		return fmt.Errorf("invalid function name: %q", f.Name)
+	}
+	for _, parameter := range f.Parameters {
+		if !identifierPattern.MatchString(parameter.Name) {
+			return fmt.Errorf("invalid parameter name: %q", parameter.Name)
+		}
+		if err := parameter.Type.validate(); err != nil {
+			return fmt.Errorf("parameter %s: %w", parameter.Name, err)
+		}
+	}
+	if f.ReturnType != TypeVoid {
+		if err := f.ReturnType.validate(); err != nil {
+			return fmt.Errorf("return type: %w", err)
+		}
+	}
+	return nil
+}
+
+// GenerateHarness wraps the code with a driver that reads the parameters of the function from stdin,
+// calls it and prints what it returns.
+func GenerateHarness(language Language, code string, fn FunctionSpec) (Harness, error) {
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		return Harness{}, err
+	}
+
+	generate, ok := harnessGenerators[spec.Harness]
+	if !ok {
+		return Harness{}, fmt.Errorf("function questions are not supported for %s", language)
+	}
+
+	if err := fn.Validate(); err != nil {
+		return Harness{}, err
+	}
+	return generate(code, fn.withDefaults())
+}
+
+// newHarness joins the prelude, the code and the driver.
+func newHarness(prelude string, code string, driver string) Harness {
+	return Harness{
+		Program:    prelude + code + "\n" + driver,
+		LineOffset: strings.Count(prelude, "\n"),
+	}
+}
+
+// remapHarnessFrames reports the sanitizer findings and the memcheck records of a run of a harness relative to the submission.
+// Frames in the code the harness generated around the submission are dropped, lines of the submission are shifted back by
+// the line offset of the harness, and every finding and record is placed at its first remaining frame in a submission file.
+func remapHarnessFrames(result *ExecutionResult, sourceFile string, names map[string]bool, lineOffset int, submissionLines int) {
+	// inSubmission shifts a line of the source file back to the submission, false for a line of generated code
+	inSubmission := func(file string, line int) (int, bool) {
+		if file != sourceFile {
+			return line, true
+		}
+		line -= lineOffset
+		return line, line >= 1 && line <= submissionLines
+	}
+
+	remap := func(file *string, line *int, stack []StackFrame) []StackFrame {
+		if *file != "" {
+			if shifted, ok := inSubmission(*file, *line); ok {
+				*line = shifted
+			} else {
+				*file, *line = "", 0
+			}
+		}
+
+		frames := stack[:0]
+		for _, frame := range stack {
+			shifted, ok := inSubmission(frame.File, frame.Line)
+			if !ok {
+				continue
+			}
+			frame.Line = shifted
+			frames = append(frames, frame)
+			if *file == "" && names[frame.File] {
+				*file, *line = frame.File, frame.Line
+			}
+		}
+		return frames
+	}
+
+	for i := range result.Findings {
+		finding := &result.Findings[i]
+		finding.Stack = remap(&finding.File, &finding.Line, finding.Stack)
+	}
+	if result.Memcheck != nil {
+		for _, records := range [][]MemcheckRecord{result.Memcheck.Leaks, result.Memcheck.Errors} {
+			for i := range records {
+				records[i].Stack = remap(&records[i].File, &records[i].Line, records[i].Stack)
+			}
+		}
+	}
+}
+
+// argName returns the name of the local holding the i-th argument in generated code.
+func argName(i int) string {
+	return fmt.Sprintf("harness_arg%d", i)
+}
+
+const cPrelude = `#include <stdbool.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#define main harness_student_main
+`
+
+const cHelpers = `#undef main
+
+static inline char *harness_line(void) {
+	size_t cap = 64, len = 0;
+	char *line = malloc(cap);
+	int c;
+	while ((c = getchar()) != EOF && c != '\n') {
+		if (len + 1 == cap) {
+			line = realloc(line, cap *= 2);
+		}
+		line[len++] = (char)c;
+	}
+	if (len > 0 && line[len - 1] == '\r') {
+		len--;
+	}
+	line[len] = '\0';
+	return line;
+}
+
+static inline char *harness_token(char *line) {
+	char *token = strtok(line, " \t");
+	return token ? token : "";
+}
+
+static inline bool harness_bool(const char *s) {
+	return strcmp(s, "true") == 0 || strcmp(s, "1") == 0;
+}
+`
+
+// cTypes are the C types of the scalar types.
+var cTypes = map[ValueType]string{
+	TypeInt:    "int",
+	TypeLong:   "long long",
+	TypeDouble: "double",
+	TypeBool:   "bool",
+	TypeChar:   "char",
+	TypeString: "char *",
+}
+
+// cParse returns the C expression parsing the string expression as a value of the scalar type.
+func cParse(t ValueType, s string) string {
+	switch t {
+	case TypeInt:
+		return fmt.Sprintf("(int)strtol(%s, NULL, 10)", s)
+	case TypeLong:
+		return fmt.Sprintf("strtoll(%s, NULL, 10)", s)
+	case TypeDouble:
+		return fmt.Sprintf("strtod(%s, NULL)", s)
+	case TypeBool:
+		return fmt.Sprintf("harness_bool(%s)", s)
+	case TypeChar:
+		return fmt.Sprintf("%s[0]", s)
+	default:
+		return s
+	}
+}
+
+// cHarness calls a free C function, passing arrays as a pointer and a length.
+func cHarness(code string, fn FunctionSpec) (Harness, error) {
+	if fn.ReturnType.IsArray() {
+		return Harness{}, fmt.Errorf("C functions cannot return arrays")
+	}
+
+	var driver strings.Builder
+	driver.WriteString(cHelpers)
+	driver.WriteString("\nint main(void) {\n")
+
+	// Everything the driver allocates is freed after the call, so leak checks only find the leaks of the submission
+	var args, allocations []string
+	for i, parameter := range fn.Parameters {
+		arg := argName(i)
+		fmt.Fprintf(&driver, "\tchar *%s_line = harness_line();\n", arg)
+		allocations = append(allocations, arg+"_line")
+		if !parameter.Type.IsArray() {
+			fmt.Fprintf(&driver, "\t%s %s = %s;\n", cTypes[parameter.Type], arg, cParse(parameter.Type, arg+"_line"))
+			args = append(args, arg)
+			continue
+		}
+
+		elem := parameter.Type.Elem()
+		fmt.Fprintf(&driver, "\tint %s_size = atoi(harness_token(%s_line));\n", arg, arg)
+		fmt.Fprintf(&driver, "\t%s *%s = malloc(sizeof(%s) * (%s_size + 1));\n", cTypes[elem], arg, cTypes[elem], arg)
+		fmt.Fprintf(&driver, "\tfor (int i = 0; i < %s_size; i++) {\n\t\t%s[i] = %s;\n\t}\n", arg, arg, cParse(elem, "harness_token(NULL)"))
+		args = append(args, arg, arg+"_size")
+		allocations = append(allocations, arg)
+	}
+
+	call := fmt.Sprintf("%s(%s)", fn.Name, strings.Join(args, ", "))
+	switch fn.ReturnType {
+	case TypeVoid:
+		fmt.Fprintf(&driver, "\t%s;\n", call)
+	case TypeInt:
+		fmt.Fprintf(&driver, "\tprintf(\"%%d\\n\", %s);\n", call)
+	case TypeLong:
+		fmt.Fprintf(&driver, "\tprintf(\"%%lld\\n\", (long long)%s);\n", call)
+	case TypeDouble:
+		fmt.Fprintf(&driver, "\tprintf(\"%%.6f\\n\", (double)%s);\n", call)
+	case TypeBool:
+		fmt.Fprintf(&driver, "\tputs(%s ? \"true\" : \"false\");\n", call)
+	case TypeChar:
+		fmt.Fprintf(&driver, "\tprintf(\"%%c\\n\", %s);\n", call)
+	case TypeString:
+		fmt.Fprintf(&driver, "\tconst char *harness_result = %s;\n\tputs(harness_result ? harness_result : \"\");\n", call)
+		allocations = append(allocations, "(char *)harness_result")
+	}
+	for _, allocation := range allocations {
+		fmt.Fprintf(&driver, "\tfree(%s);\n", allocation)
+	}
+	driver.WriteString("\treturn 0;\n}\n")
+
+	return newHarness(cPrelude, code, driver.String()), nil
+}
+
+const cppPrelude = `#include <cstdio>
+#include <cstdlib>
+#include <iomanip>
+#include <iostream>
+#include <sstream>
+#include <string>
+#include <vector>
+#define main harness_student_main
+`
+
+const cppHelpers = `#undef main
+
+static inline std::string harness_line() {
+	std::string line;
+	std::getline(std::cin, line);
+	if (!line.empty() && line.back() == '\r') {
+		line.pop_back();
+	}
+	return line;
+}
+
+static inline bool harness_bool(const std::string &s) {
+	return s == "true" || s == "1";
+}
+
+static inline void harness_print(int v) { std::cout << v; }
+static inline void harness_print(long long v) { std::cout << v; }
+static inline void harness_print(double v) { std::cout << std::fixed << std::setprecision(6) << v; }
+static inline void harness_print(bool v) { std::cout << (v ? "true" : "false"); }
+static inline void harness_print(char v) { std::cout << v; }
+static inline void harness_print(const std::string &v) { std::cout << v; }
+
+template <typename T>
+static inline void harness_print(const std::vector<T> &v) {
+	for (size_t i = 0; i < v.size(); i++) {
+		if (i > 0) {
+			std::cout << ' ';
+		}
+		harness_print(static_cast<T>(v[i]));
+	}
+}
+`
+
+// cppTypes are the C++ types of the scalar types.
+var cppTypes = map[ValueType]string{
+	TypeInt:    "int",
+	TypeLong:   "long long",
+	TypeDouble: "double",
+	TypeBool:   "bool",
+	TypeChar:   "char",
+	TypeString: "std::string",
+}
+
+// cppType returns the C++ type of the type, arrays being vectors.
+func cppType(t ValueType) string {
+	if t.IsArray() {
+		return "std::vector<" + cppTypes[t.Elem()] + ">"
+	}
+	return cppTypes[t]
+}
+
+// cppParse returns the C++ expression parsing the std::string expression as a value of the scalar type.
+func cppParse(t ValueType, s string) string {
+	switch t {
+	case TypeString:
+		return s
+	case TypeChar:
+		return fmt.Sprintf("(%s + '\\0')[0]", s)
+	default:
+		return cParse(t, s+".c_str()")
+	}
+}
+
+// cppHarness calls a free C++ function, passing arrays as vectors.
+func cppHarness(code string, fn FunctionSpec) (Harness, error) {
+	var driver strings.Builder
+	driver.WriteString(cppHelpers)
+	driver.WriteString("\nint main() {\n")
+
+	var args []string
+	for i, parameter := range fn.Parameters {
+		arg := argName(i)
+		args = append(args, arg)
+		if !parameter.Type.IsArray() {
+			fmt.Fprintf(&driver, "\t%s %s = %s;\n", cppType(parameter.Type), arg, cppParse(parameter.Type, "harness_line()"))
+			continue
+		}
+
+		fmt.Fprintf(&driver, "\tstd::istringstream %s_in(harness_line());\n", arg)
+		fmt.Fprintf(&driver, "\tint %s_size = 0;\n\t%s_in >> %s_size;\n", arg, arg, arg)
+		fmt.Fprintf(&driver, "\t%s %s(%s_size > 0 ? %s_size : 0);\n", cppType(parameter.Type), arg, arg, arg)
+		fmt.Fprintf(&driver, "\tfor (int i = 0; i < %s_size; i++) {\n\t\tstd::string token;\n\t\t%s_in >> token;\n\t\t%s[i] = %s;\n\t}\n",
+			arg, arg, arg, cppParse(parameter.Type.Elem(), "token"))
+	}
+
+	call := fmt.Sprintf("%s(%s)", fn.Name, strings.Join(args, ", "))
+	if fn.ReturnType == TypeVoid {
+		fmt.Fprintf(&driver, "\t%s;\n", call)
+	} else {
+		fmt.Fprintf(&driver, "\t%s harness_result = %s;\n", cppType(fn.ReturnType), call)
+		driver.WriteString("\tharness_print(harness_result);\n\tstd::cout << '\\n';\n")
+	}
+	driver.WriteString("\treturn 0;\n}\n")
+
+	return newHarness(cppPrelude, code, driver.String()), nil
+}
+
+const javaHelpers = `
+class Main {
+    private static java.io.BufferedReader in = new java.io.BufferedReader(new java.io.InputStreamReader(System.in));
+
+    private static String line() throws java.io.IOException {
+        String line = in.readLine();
+        return line == null ? "" : line;
+    }
+
+    private static String[] tokens() throws java.io.IOException {
+        String line = line().trim();
+        return line.isEmpty() ? new String[0] : line.split("\\s+");
+    }
+
+    private static boolean parseBool(String s) {
+        s = s.trim();
+        return s.equals("true") || s.equals("1");
+    }
+
+    private static char parseChar(String s) {
+        return s.isEmpty() ? '\0' : s.charAt(0);
+    }
+
+    private static String format(Object value) {
+        if (value instanceof Double) {
+            return String.format(java.util.Locale.ROOT, "%.6f", value);
+        }
+        if (value != null && value.getClass().isArray()) {
+            StringBuilder out = new StringBuilder();
+            for (int i = 0; i < java.lang.reflect.Array.getLength(value); i++) {
+                if (i > 0) {
+                    out.append(' ');
+                }
+                out.append(format(java.lang.reflect.Array.get(value, i)));
+            }
+            return out.toString();
+        }
+        return String.valueOf(value);
+    }
+
+    public static void main(String[] args) throws Exception {
+`
+
+// javaTypes are the Java types of the scalar types.
+var javaTypes = map[ValueType]string{
+	TypeInt:    "int",
+	TypeLong:   "long",
+	TypeDouble: "double",
+	TypeBool:   "boolean",
+	TypeChar:   "char",
+	TypeString: "String",
+}
+
+// javaParse returns the Java expression parsing the String expression as a value of the scalar type.
+func javaParse(t ValueType, s string) string {
+	switch t {
+	case TypeInt:
+		return fmt.Sprintf("Integer.parseInt(%s.trim())", s)
+	case TypeLong:
+		return fmt.Sprintf("Long.parseLong(%s.trim())", s)
+	case TypeDouble:
+		return fmt.Sprintf("Double.parseDouble(%s.trim())", s)
+	case TypeBool:
+		return fmt.Sprintf("parseBool(%s)", s)
+	case TypeChar:
+		return fmt.Sprintf("parseChar(%s)", s)
+	default:
+		return s
+	}
+}
+
+// javaHarness calls a method of the Solution class of the submission from the Main class.
+func javaHarness(code string, fn FunctionSpec) (Harness, error) {
+	var driver strings.Builder
+	driver.WriteString(javaHelpers)
+
+	var args []string
+	for i, parameter := range fn.Parameters {
+		arg := argName(i)
+		args = append(args, arg)
+		if !parameter.Type.IsArray() {
+			fmt.Fprintf(&driver, "        %s %s = %s;\n", javaTypes[parameter.Type], arg, javaParse(parameter.Type, "line()"))
+			continue
+		}
+
+		elem := javaTypes[parameter.Type.Elem()]
+		fmt.Fprintf(&driver, "        String[] %s_tokens = tokens();\n", arg)
+		fmt.Fprintf(&driver, "        int %s_size = %s_tokens.length > 0 ? Integer.parseInt(%s_tokens[0]) : 0;\n", arg, arg, arg)
+		fmt.Fprintf(&driver, "        %s[] %s = new %s[%s_size];\n", elem, arg, elem, arg)
+		fmt.Fprintf(&driver, "        for (int i = 0; i < %s_size; i++) {\n            %s[i] = %s;\n        }\n",
+			arg, arg, javaParse(parameter.Type.Elem(), arg+"_tokens[i + 1]"))
+	}
+
+	call := fmt.Sprintf("new Solution().%s(%s)", fn.Name, strings.Join(args, ", "))
+	if fn.ReturnType == TypeVoid {
+		fmt.Fprintf(&driver, "        %s;\n", call)
+	} else {
+		fmt.Fprintf(&driver, "        System.out.println(format(%s));\n", call)
+	}
+	driver.WriteString("    }\n}\n")
+
+	return newHarness("", code, driver.String()), nil
+}
+
+const pythonHelpers = `
+import sys as harness_sys
+
+
+def harness_line():
+    return harness_sys.stdin.readline().rstrip("\r\n")
+
+
+def harness_parse(value, kind):
+    if kind.endswith("[]"):
+        tokens = value.split()
+        size = int(tokens[0]) if tokens else 0
+        return [harness_parse(token, kind[:-2]) for token in tokens[1:size + 1]]
+    if kind == "int" or kind == "long":
+        return int(value)
+    if kind == "double":
+        return float(value)
+    if kind == "bool":
+        return value.strip() in ("true", "1")
+    if kind == "char":
+        return value[:1]
+    return value
+
+
+def harness_format(value, kind):
+    if kind.endswith("[]"):
+        return " ".join(harness_format(item, kind[:-2]) for item in value)
+    if kind == "double":
+        return "%.6f" % float(value)
+    if kind == "bool":
+        return "true" if value else "false"
+    return str(value)
+
+`
+
+// pythonHarness calls a top level function of the submission, or a method of its Solution class.
+func pythonHarness(code string, fn FunctionSpec) (Harness, error) {
+	var driver strings.Builder
+	driver.WriteString(pythonHelpers)
+
+	var args []string
+	for i, parameter := range fn.Parameters {
+		arg := argName(i)
+		args = append(args, arg)
+		fmt.Fprintf(&driver, "%s = harness_parse(harness_line(), %q)\n", arg, parameter.Type)
+	}
+
+	fmt.Fprintf(&driver, "if %q in globals():\n    harness_function = %s\nelse:\n    harness_function = getattr(Solution(), %q)\n", fn.Name, fn.Name, fn.Name)
+
+	call := fmt.Sprintf("harness_function(%s)", strings.Join(args, ", "))
+	if fn.ReturnType == TypeVoid {
+		fmt.Fprintf(&driver, "%s\n", call)
+	} else {
+		fmt.Fprintf(&driver, "print(harness_format(%s, %q))\n", call, fn.ReturnType)
+	}
+
+	return newHarness("", code, driver.String()), nil
+}
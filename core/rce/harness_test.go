@@ -0,0 +1,244 @@
+package rce
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runHarness builds the program of the harness with the toolchain of the language on the host and runs it with the input,
+// returning its stdout. C and C++ programs are built with AddressSanitizer, so a harness leaking what it allocates fails.
+// The test is skipped when the toolchain is missing.
+func runHarness(t *testing.T, language Language, program string, input string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	var source string
+	var build, run []string
+	switch language {
+	case C:
+		source, build, run = "main.c", []string{"gcc", "-fsanitize=address", "-o", "main", "main.c"}, []string{"./main"}
+	case CPP:
+		source, build, run = "main.cpp", []string{"g++", "-fsanitize=address", "-o", "main", "main.cpp"}, []string{"./main"}
+	case JAVA:
+		source, build, run = "Main.java", []string{"javac", "Main.java"}, []string{"java", "Main"}
+	case PYTHON:
+		source, run = "main.py", []string{"python3", "main.py"}
+	default:
+		t.Fatalf("no toolchain for %s", language)
+	}
+
+	for _, tool := range [][]string{build, run} {
+		if len(tool) == 0 || strings.HasPrefix(tool[0], "./") {
+			continue
+		}
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			t.Skipf("%s is not installed", tool[0])
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, source), []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if len(build) > 0 {
+		cmd := exec.Command(build[0], build[1:]...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failed to build the harness: %v\n%s\n%s", err, output, program)
+		}
+	}
+
+	cmd := exec.Command(run[0], run[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("failed to run the harness: %v\n%s", err, program)
+	}
+	return string(output)
+}
+
+func TestGenerateHarness(t *testing.T) {
+	sum := FunctionSpec{
+		Name:       "sum",
+		Parameters: []Variable{{Name: "values", Type: "int[]"}, {Name: "label", Type: TypeString}},
+		ReturnType: TypeLong,
+	}
+	const sumInput, sumOutput = "3 1 2 3\ntotal\n", "6\n"
+
+	tests := []struct {
+		name     string
+		language Language
+		code     string
+		fn       FunctionSpec
+		input    string
+		output   string // Printed by the program, empty when the harness is not valid
+	}{
+		{
+			name:     "c",
+			language: C,
+			code:     "long long sum(int *values, int n, char *label) {\n\tlong long s = 0;\n\tfor (int i = 0; i < n; i++) s += values[i];\n\treturn s;\n}",
+			fn:       sum,
+			input:    sumInput,
+			output:   sumOutput,
+		},
+		{
+			name:     "c returning a string",
+			language: C,
+			code:     "#include <ctype.h>\n\nchar *upper(char *s) {\n\tchar *out = malloc(strlen(s) + 1);\n\tfor (size_t i = 0; i <= strlen(s); i++) out[i] = toupper(s[i]);\n\treturn out;\n}",
+			fn:       FunctionSpec{Name: "upper", Parameters: []Variable{{Name: "s", Type: TypeString}}, ReturnType: TypeString},
+			input:    "abc\n",
+			output:   "ABC\n",
+		},
+		{
+			name:     "c returning an array",
+			language: C,
+			code:     "int *f(void) { return 0; }",
+			fn:       FunctionSpec{Name: "f", ReturnType: "int[]"},
+		},
+		{
+			name:     "cpp",
+			language: CPP,
+			code:     "long long sum(std::vector<int> values, std::string label) {\n\tlong long s = 0;\n\tfor (int v : values) s += v;\n\treturn s;\n}",
+			fn:       sum,
+			input:    sumInput,
+			output:   sumOutput,
+		},
+		{
+			name:     "cpp returning an array",
+			language: CPP,
+			code:     "std::vector<bool> flip(std::vector<bool> values) {\n\tfor (size_t i = 0; i < values.size(); i++) values[i] = !values[i];\n\treturn values;\n}",
+			fn:       FunctionSpec{Name: "flip", Parameters: []Variable{{Name: "values", Type: "bool[]"}}, ReturnType: "bool[]"},
+			input:    "3 true false 1\n",
+			output:   "false true false\n",
+		},
+		{
+			name:     "java",
+			language: JAVA,
+			code:     "class Solution {\n\tlong sum(int[] values, String label) {\n\t\tlong s = 0;\n\t\tfor (int v : values) s += v;\n\t\treturn s;\n\t}\n}",
+			fn:       sum,
+			input:    sumInput,
+			output:   sumOutput,
+		},
+		{
+			name:     "python",
+			language: PYTHON,
+			code:     "def sum(values, label):\n    total = 0\n    for v in values:\n        total += v\n    return total",
+			fn:       sum,
+			input:    sumInput,
+			output:   sumOutput,
+		},
+		{
+			name:     "invalid function name",
+			language: C,
+			code:     "void f(void) {}",
+			fn:       FunctionSpec{Name: "f(); system(\"id\")"},
+		},
+		{
+			name:     "invalid parameter type",
+			language: CPP,
+			code:     "void f(int x) {}",
+			fn:       FunctionSpec{Name: "f", Parameters: []Variable{{Name: "x", Type: "map"}}},
+		},
+		{
+			name:     "unknown language",
+			language: "cobol",
+			code:     "",
+			fn:       sum,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			harness, err := GenerateHarness(test.language, test.code, test.fn)
+			if valid := test.output != ""; (err == nil) != valid {
+				t.Fatalf("GenerateHarness() = %v, want valid %v", err, valid)
+			}
+			if err != nil {
+				return
+			}
+
+			// The submission starts right after the lines the harness puts before it
+			lines := strings.Split(harness.Program, "\n")
+			if got := lines[harness.LineOffset]; got != strings.Split(test.code, "\n")[0] {
+				t.Fatalf("line %d of the program is %q, want the first line of the code", harness.LineOffset+1, got)
+			}
+
+			if got := runHarness(t, test.language, harness.Program, test.input); got != test.output {
+				t.Fatalf("output %q, want %q", got, test.output)
+			}
+		})
+	}
+}
+
+func TestRemapHarnessFrames(t *testing.T) {
+	names := map[string]bool{"main.c": true}
+	// The submission is lines 5 to 7 of main.c, the rest is the harness
+	const lineOffset, submissionLines = 4, 3
+
+	result := ExecutionResult{
+		Findings: []SanitizerFinding{
+			{
+				Kind: "undefined-behavior",
+				File: "main.c",
+				Line: 6,
+				Stack: []StackFrame{
+					{Function: "add", File: "main.c", Line: 6},
+					{Function: "main", File: "main.c", Line: 40},
+				},
+			},
+			{
+				Kind: "heap-buffer-overflow",
+				File: "main.c",
+				Line: 30,
+				Stack: []StackFrame{
+					{Function: "harness_line", File: "main.c", Line: 30},
+					{Function: "sum", File: "main.c", Line: 7},
+					{Function: "__libc_start_main"},
+				},
+			},
+		},
+		Memcheck: &MemcheckReport{
+			Leaks: []MemcheckRecord{{
+				Kind: "Leak_DefinitelyLost",
+				File: "main.c",
+				Line: 2,
+				Stack: []StackFrame{
+					{Function: "malloc"},
+					{Function: "harness_line", File: "main.c", Line: 2},
+				},
+			}},
+		},
+	}
+
+	remapHarnessFrames(&result, "main.c", names, lineOffset, submissionLines)
+
+	wantFindings := []SanitizerFinding{
+		{
+			Kind:  "undefined-behavior",
+			File:  "main.c",
+			Line:  2,
+			Stack: []StackFrame{{Function: "add", File: "main.c", Line: 2}},
+		},
+		{
+			Kind: "heap-buffer-overflow",
+			File: "main.c",
+			Line: 3,
+			Stack: []StackFrame{
+				{Function: "sum", File: "main.c", Line: 3},
+				{Function: "__libc_start_main"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(result.Findings, wantFindings) {
+		t.Fatalf("findings =\n%+v\nwant\n%+v", result.Findings, wantFindings)
+	}
+
+	wantLeaks := []MemcheckRecord{{Kind: "Leak_DefinitelyLost", Stack: []StackFrame{{Function: "malloc"}}}}
+	if !reflect.DeepEqual(result.Memcheck.Leaks, wantLeaks) {
+		t.Fatalf("leaks =\n%+v\nwant\n%+v", result.Memcheck.Leaks, wantLeaks)
+	}
+}
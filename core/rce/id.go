@@ -0,0 +1,15 @@
+package rce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID returns a random identifier that is unique per job.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
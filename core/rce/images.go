@@ -0,0 +1,229 @@
+package rce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// ImageSource is where missing runner images are fetched from.
+type ImageSource struct {
+	Registry   string // Registry the images are pulled from, e.g. registry.example.com/judge; empty pulls from Docker Hub
+	TarballDir string // Directory of `docker save` archives named after the image (gcc.tar, python_3.12.tar), loaded instead of pulling when present
+}
+
+// ImageStatus is the state of the image of a language.
+type ImageStatus struct {
+	Language Language `json:"language"`
+	Image    string   `json:"image"`
+	Present  bool     `json:"present"`
+	Fetched  bool     `json:"fetched"` // Pulled or loaded by this check
+	Version  string   `json:"version"` // First line printed by the version command of the language
+	Error    string   `json:"error,omitempty"`
+}
+
+// PrepareImages makes sure the image of every registered language is present, fetching missing ones from the source,
+// and reports the toolchain version in each image. The error lists every language whose image is still missing.
+// Languages with a separate memcheck image get a status for it too, and a missing one counts as missing for the language:
+// questions requiring leak-free code run every submission in it.
+func (d *DockerRunner) PrepareImages(ctx context.Context, source ImageSource) ([]ImageStatus, error) {
+	registry := DefaultRegistry()
+	languages := registry.Languages()
+
+	statuses := make([]ImageStatus, 0, len(languages))
+	fetched := map[string]error{} // Images shared by several languages are fetched once
+	var missing []string
+
+	for _, language := range languages {
+		spec, err := registry.Get(language)
+		if err != nil {
+			return nil, err
+		}
+
+		status := d.prepareImage(ctx, spec, source, fetched)
+		if !status.Present {
+			missing = append(missing, string(language))
+		}
+		statuses = append(statuses, status)
+
+		if spec.Memcheck != nil && spec.Memcheck.Image != "" && spec.Memcheck.Image != spec.Image {
+			spec.Image = spec.Memcheck.Image
+			status := d.prepareImage(ctx, spec, source, fetched)
+			if !status.Present {
+				missing = append(missing, string(language)+" memcheck")
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	if len(missing) > 0 {
+		return statuses, fmt.Errorf("runner images missing for: %s", strings.Join(missing, ", "))
+	}
+	return statuses, nil
+}
+
+// prepareImage fetches the image of the spec from the source unless it is present or was fetched before, and reports its toolchain version.
+func (d *DockerRunner) prepareImage(ctx context.Context, spec LanguageSpec, source ImageSource, fetched map[string]error) ImageStatus {
+	status := ImageStatus{Language: spec.ID, Image: spec.Image}
+
+	present, err := imageExists(ctx, d.apiClient, spec.Image)
+	if err == nil && !present {
+		fetchErr, ok := fetched[spec.Image]
+		if !ok {
+			log.Printf("Fetching runner image %s", spec.Image)
+			fetchErr = fetchImage(ctx, d.apiClient, spec.Image, source)
+			fetched[spec.Image] = fetchErr
+			status.Fetched = fetchErr == nil
+		}
+		err = fetchErr
+		present = fetchErr == nil
+	}
+	status.Present = present
+
+	if err == nil {
+		status.Version, err = d.toolchainVersion(ctx, spec)
+	}
+	if err != nil {
+		log.Printf("Failed to prepare runner image %s: %v", spec.Image, err)
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// toolchainVersion runs the version command of the language in a new container and returns the first line it prints.
+func (d *DockerRunner) toolchainVersion(ctx context.Context, spec LanguageSpec) (string, error) {
+	if spec.VersionCmd == nil {
+		return "", nil
+	}
+
+	containerID, err := startSandboxContainer(ctx, d.apiClient, spec, Resources{Memory: CompileMemoryLimit}.withDefaults(spec.DefaultResources()), d.sandboxLabels(time.Now().Add(SandboxDeadline)))
+	if err != nil {
+		return "", err
+	}
+	defer removeContainer(context.Background(), d.apiClient, containerID)
+
+	sandbox := &Sandbox{ID: containerID, Language: spec.ID, spec: spec}
+	result, err := d.execute(ctx, sandbox, spec.VersionCmd, strings.NewReader(""), DefaultCompileLimits, nil)
+	if err != nil {
+		return "", err
+	}
+	if result.Verdict != VerdictOK {
+		return "", fmt.Errorf("version command failed: %s", result.Verdict)
+	}
+
+	// Some toolchains (java -version) print the version to stderr
+	for _, line := range strings.Split(result.Stdout+result.Stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+	return "", nil
+}
+
+// imageExists reports whether the image is present on the Docker host.
+func imageExists(ctx context.Context, apiClient *client.Client, ref string) (bool, error) {
+	if _, _, err := apiClient.ImageInspectWithRaw(ctx, ref); err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// imageID returns the ID of the image on the Docker host, which changes whenever the image is rebuilt.
+func imageID(ctx context.Context, apiClient *client.Client, ref string) (string, error) {
+	inspect, _, err := apiClient.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+// fetchImage loads the image from its tarball in the source, or pulls it from the source registry and tags it with the name the registry uses.
+func fetchImage(ctx context.Context, apiClient *client.Client, ref string, source ImageSource) error {
+	if source.TarballDir != "" {
+		tarball := filepath.Join(source.TarballDir, tarballName(ref))
+		file, err := os.Open(tarball)
+		if err == nil {
+			defer file.Close()
+			return loadImage(ctx, apiClient, file)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	remote := ref
+	if source.Registry != "" {
+		remote = strings.TrimSuffix(source.Registry, "/") + "/" + ref
+	}
+
+	if err := pullImage(ctx, apiClient, remote); err != nil {
+		return err
+	}
+	if remote != ref {
+		return apiClient.ImageTag(ctx, remote, ref)
+	}
+	return nil
+}
+
+// tarballName returns the file name of the archive of the image in the tarball directory.
+func tarballName(ref string) string {
+	return strings.NewReplacer("/", "_", ":", "_").Replace(ref) + ".tar"
+}
+
+// loadImage loads a `docker save` archive into the Docker host.
+func loadImage(ctx context.Context, apiClient *client.Client, archive io.Reader) error {
+	resp, err := apiClient.ImageLoad(ctx, archive, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !resp.JSON {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return readProgress(resp.Body)
+}
+
+// pullImage pulls the image into the Docker host, waiting for the pull to finish.
+func pullImage(ctx context.Context, apiClient *client.Client, ref string) error {
+	progress, err := apiClient.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer progress.Close()
+
+	return readProgress(progress)
+}
+
+// readProgress reads a JSON progress stream of the Docker daemon to the end and returns the error it reports, if any.
+func readProgress(stream io.Reader) error {
+	decoder := json.NewDecoder(stream)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+	}
+}
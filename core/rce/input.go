@@ -0,0 +1,31 @@
+package rce
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Input is the data streamed into a program's stdin, either a string or the contents of a file.
+type Input struct {
+	Data string
+	Path string // Takes precedence over Data when set
+}
+
+// StringInput returns an Input that streams the given string.
+func StringInput(data string) Input {
+	return Input{Data: data}
+}
+
+// FileInput returns an Input that streams the contents of the file at the given path.
+func FileInput(path string) Input {
+	return Input{Path: path}
+}
+
+// Open returns a reader over the input data.
+func (i Input) Open() (io.ReadCloser, error) {
+	if i.Path != "" {
+		return os.Open(i.Path)
+	}
+	return io.NopCloser(strings.NewReader(i.Data)), nil
+}
@@ -0,0 +1,202 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// InteractorSpec is the teacher supplied program an interactive question runs submissions against.
+// The stdout of each program is the stdin of the other. The interactor gets the input and the expected output
+// as files and passed as arguments like testlib expects (input, output, answer), and decides the verdict with a testlib exit code.
+type InteractorSpec struct {
+	Program  string   `json:"program"`
+	Language Language `json:"language"`
+}
+
+// TranscriptEntry is what one side of an interaction wrote at once.
+type TranscriptEntry struct {
+	From string        `json:"from"` // program or interactor
+	Data string        `json:"data"`
+	At   time.Duration `json:"at"` // Since the interaction started
+}
+
+const (
+	transcriptProgram    = "program"
+	transcriptInteractor = "interactor"
+)
+
+// maxTranscriptSize caps the bytes recorded in the transcript of an interaction.
+const maxTranscriptSize = 64 << 10
+
+// interactorGrace is the wall time the interactor gets on top of the program, so it can still judge a program that used all of its own.
+const interactorGrace = time.Second
+
+// signalPipe is the signal killing a program that writes to an interactor that already exited.
+const signalPipe = 13
+
+// Validate checks that the spec describes a usable interactor.
+func (s InteractorSpec) Validate() error {
+	if s.Program == "" {
+		return fmt.Errorf("interactor has no program")
+	}
+	_, err := lookupLanguage(s.Language)
+	return err
+}
+
+// interactor runs the interactor program in its own sandbox next to the program.
+type interactor struct {
+	*helperProgram
+}
+
+// newInteractor compiles the interactor program of the spec, for a job taking up to the wall time budget.
+func newInteractor(ctx context.Context, runner Runner, spec InteractorSpec, budget time.Duration) (*interactor, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	helper, err := newHelperProgram(ctx, runner, "interactor", spec.Program, spec.Language, budget)
+	if err != nil {
+		return nil, err
+	}
+	helper.sandbox.Args = []string{CheckerInputFile, CheckerOutputFile, CheckerAnswerFile}
+	return &interactor{helper}, nil
+}
+
+// run runs the compiled program in the sandbox against the interactor for the test case.
+// A program that failed on its own keeps its verdict, otherwise the interactor decides it.
+func (it *interactor) run(ctx context.Context, runner Runner, sandbox *Sandbox, test TestCase, limits Limits) (ExecutionResult, error) {
+	inputData, err := readInput(test.Input)
+	if err != nil {
+		log.Printf("Failed to read input: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+
+	err = it.prepare(ctx, []File{
+		{Name: CheckerInputFile, Content: inputData},
+		{Name: CheckerAnswerFile, Content: []byte(test.Expected)},
+	})
+	if err != nil {
+		log.Printf("Failed to prepare interactor: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+
+	programIn, interactorOut := io.Pipe()
+	interactorIn, programOut := io.Pipe()
+
+	transcript := newTranscript()
+	sandbox.stdout = transcript.writer(transcriptProgram, programOut)
+	it.sandbox.stdout = transcript.writer(transcriptInteractor, interactorOut)
+	defer func() {
+		sandbox.stdout = nil
+		it.sandbox.stdout = nil
+	}()
+
+	interactorLimits := LimitsFor(it.sandbox.Language)
+	interactorLimits.WallTime = limits.WallTime + interactorGrace
+
+	var interactorResult ExecutionResult
+	var interactorErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		interactorResult, interactorErr = it.runner.Run(ctx, it.sandbox, interactorIn, interactorLimits)
+		// Whatever the program still reads or writes goes nowhere
+		interactorOut.Close()
+		interactorIn.Close()
+	}()
+
+	result, err := runner.Run(ctx, sandbox, programIn, limits)
+	programOut.Close()
+	programIn.Close()
+	wg.Wait()
+
+	if err != nil {
+		log.Printf("Failed to run program: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+	if interactorErr != nil {
+		log.Printf("Failed to run interactor: %v", interactorErr)
+		return ExecutionResult{Verdict: VerdictInternalError}, interactorErr
+	}
+
+	result.Transcript, result.TranscriptTruncated = transcript.entries()
+
+	// A program killed for writing to an interactor that already exited is judged by the interactor
+	if result.Verdict != VerdictOK && result.Signal != signalPipe {
+		return result, nil
+	}
+
+	check, err := testlibVerdict(it.name, interactorResult, interactorResult.Stderr)
+	if err != nil {
+		log.Printf("Failed to interact with program: %v", err)
+		result.Verdict = VerdictInternalError
+		result.CheckerMessage = err.Error()
+		return result, nil
+	}
+
+	if check.Verdict != VerdictAccepted || result.Verdict == VerdictOK {
+		result.Verdict = check.Verdict
+	}
+	result.CheckerMessage = check.Message
+	return result, nil
+}
+
+// transcript records both sides of an interaction in the order they wrote.
+type transcript struct {
+	mu        sync.Mutex
+	start     time.Time
+	list      []TranscriptEntry
+	size      int
+	truncated bool
+}
+
+// newTranscript starts a transcript at the current time.
+func newTranscript() *transcript {
+	return &transcript{start: time.Now()}
+}
+
+// writer returns the writer recording what the side writes before passing it on to w.
+func (t *transcript) writer(from string, w io.Writer) io.Writer {
+	return &transcriptWriter{transcript: t, from: from, w: w}
+}
+
+// record appends what the side wrote, up to the size of the transcript.
+func (t *transcript) record(from string, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.size+len(p) > maxTranscriptSize {
+		p = p[:maxTranscriptSize-t.size]
+		t.truncated = true
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	t.list = append(t.list, TranscriptEntry{From: from, Data: string(p), At: time.Since(t.start)})
+	t.size += len(p)
+}
+
+// entries returns the recorded entries and whether anything was left out.
+func (t *transcript) entries() ([]TranscriptEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.list, t.truncated
+}
+
+// transcriptWriter records one side of an interaction.
+type transcriptWriter struct {
+	transcript *transcript
+	from       string
+	w          io.Writer
+}
+
+func (w *transcriptWriter) Write(p []byte) (int, error) {
+	w.transcript.record(w.from, p)
+	return w.w.Write(p)
+}
@@ -0,0 +1,295 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// JobStatus is the stage a judge job is in.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "QUEUED"
+	JobCompiling JobStatus = "COMPILING"
+	JobRunning   JobStatus = "RUNNING"
+	JobDone      JobStatus = "DONE"
+)
+
+// Job is a program to compile once and run against every test case in the same sandbox.
+type Job struct {
+	Program   string
+	Language  Language
+	Limits    Limits    // Limits of every test case that does not set its own
+	Resources Resources // Memory, processes and CPU share of the sandbox, zero fields use the defaults of the language
+	Tests     []TestCase
+	Files     []File         // Extra files placed next to the program
+	Checker   *CheckerSpec   // Judges the output of every test case against its expected output, nil leaves runs unjudged
+	Function  *FunctionSpec  // Function of the program called through a generated harness, nil runs the program as is
+	Sanitize  bool           // Debug run: build with sanitizers and report their findings with every result, slow so meant for sample tests
+	Memcheck  bool           // Run every test case under Valgrind memcheck with raised time limits, reporting leaks and invalid accesses
+	Flags     *CompilerFlags // Compiler flags of the question, nil builds with the compile command of the language
+
+	// RequireLeakFree runs the job under memcheck like Memcheck and gives runs that were not leak free VerdictMemoryLeak instead of OK or accepted.
+	RequireLeakFree bool
+
+	// Interactor talks to the program of every test case and decides its verdict, nil feeds the input to the program.
+	// A job has either a checker or an interactor.
+	Interactor *InteractorSpec
+
+	// OnStatus is called when the job starts compiling and when it starts running, if set.
+	OnStatus func(status JobStatus)
+}
+
+// TestCase is an input the program of a job runs against.
+type TestCase struct {
+	Input    Input
+	Expected string // Expected output, compared by the checker of the job
+	Limits   Limits // Zero fields fall back to the limits of the job
+}
+
+// JobResult is the outcome of a job. Results is empty when compilation failed.
+type JobResult struct {
+	Compile CompileResult     `json:"compile"`
+	Results []ExecutionResult `json:"results"` // One per test case, in order
+
+	// LeakFree is set for memcheck jobs: whether every test case ran to completion without leaking memory.
+	// Questions requiring leak-free submissions withhold full marks when it is false.
+	LeakFree *bool `json:"leakFree,omitempty"`
+}
+
+// RunJob runs the job with the default runner.
+func RunJob(ctx context.Context, job Job) (JobResult, error) {
+	runner, err := getDefaultRunner()
+	if err != nil {
+		log.Printf("Failed to create runner: %v", err)
+		return JobResult{}, err
+	}
+
+	return RunJobWith(ctx, runner, job)
+}
+
+// RunJobWith compiles the program of the job once with the given runner and runs the artifact once per test case,
+// none when compilation fails. Cancelling the context stops the job and releases its sandbox; the context error is returned.
+func RunJobWith(ctx context.Context, runner Runner, job Job) (JobResult, error) {
+	if job.Checker != nil && job.Interactor != nil {
+		return JobResult{}, fmt.Errorf("a job cannot have both a checker and an interactor")
+	}
+	// Leaks are only known from memcheck, which also raises the time limits of every test case
+	if job.RequireLeakFree {
+		job.Memcheck = true
+	}
+
+	spec, err := lookupLanguage(job.Language)
+	if err != nil {
+		return JobResult{}, err
+	}
+
+	program, lineOffset := job.Program, 0
+	if job.Function != nil {
+		harness, err := GenerateHarness(job.Language, job.Program, *job.Function)
+		if err != nil {
+			log.Printf("Failed to generate harness: %v", err)
+			return JobResult{}, err
+		}
+		program, lineOffset = harness.Program, harness.LineOffset
+	}
+
+	// The sandbox holds a slot of the pool for its whole lifetime, a custom checker or an interactor runs in a second sandbox outside it
+	pool := DefaultPool()
+	if err := pool.Acquire(ctx); err != nil {
+		return JobResult{}, err
+	}
+	defer pool.Release()
+
+	budget := job.budget()
+
+	job.setStatus(JobCompiling)
+	sandbox, compile, err := runner.Compile(ctx, program, job.Language, job.Files, CompileOptions{
+		Sanitize:  job.Sanitize,
+		Memcheck:  job.Memcheck,
+		Flags:     job.Flags,
+		Resources: job.Resources,
+		Budget:    budget,
+	})
+	if err != nil {
+		log.Printf("Failed to compile program: %v", err)
+		return JobResult{}, err
+	}
+	defer func() {
+		if err := runner.Cleanup(sandbox); err != nil {
+			log.Printf("Failed to clean up sandbox: %v", err)
+		}
+	}()
+
+	// Diagnostics have lines in the submitted code, not in the harness around it
+	compile.Messages = parseDiagnostics(spec, compile.Diagnostics, program, job.Program, job.Files, lineOffset)
+	if !compile.Success {
+		return JobResult{Compile: compile}, nil
+	}
+
+	var checker Checker
+	if job.Checker != nil {
+		checker, err = newChecker(ctx, runner, *job.Checker, budget)
+		if err != nil {
+			log.Printf("Failed to create checker: %v", err)
+			return JobResult{Compile: compile}, err
+		}
+		if closer, ok := checker.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	var interactive *interactor
+	if job.Interactor != nil {
+		interactive, err = newInteractor(ctx, runner, *job.Interactor, budget)
+		if err != nil {
+			log.Printf("Failed to create interactor: %v", err)
+			return JobResult{Compile: compile}, err
+		}
+		defer interactive.Close()
+	}
+
+	names := map[string]bool{spec.SourceFile: true}
+	for _, file := range job.Files {
+		names[file.Name] = true
+	}
+	submissionLines := strings.Count(job.Program, "\n") + 1
+
+	job.setStatus(JobRunning)
+	results := make([]ExecutionResult, 0, len(job.Tests))
+	for i, test := range job.Tests {
+		// Restore the working directory to its state after compilation, so test cases cannot affect each other
+		if i > 0 {
+			if err := runner.Reset(ctx, sandbox); err != nil {
+				log.Printf("Failed to reset sandbox: %v", err)
+				return JobResult{Compile: compile}, err
+			}
+		}
+
+		limits := job.testLimits(test)
+
+		var result ExecutionResult
+		if interactive != nil {
+			result, err = interactive.run(ctx, runner, sandbox, test, limits)
+		} else {
+			result, err = runWithInput(ctx, runner, sandbox, limits, test.Input)
+		}
+		if err != nil {
+			return JobResult{Compile: compile}, err
+		}
+		// Sanitizer findings and memcheck records leave out the frames of the harness
+		if job.Function != nil {
+			remapHarnessFrames(&result, spec.SourceFile, names, lineOffset, submissionLines)
+		}
+		// Errors at run time printed like compile errors, like Python tracebacks, get diagnostics too
+		if runtimeDiagnostics[spec.Diagnostics] {
+			result.Diagnostics = parseDiagnostics(spec, result.Stderr, program, job.Program, job.Files, lineOffset)
+		}
+
+		// Only runs that ended OK have an output worth judging
+		if checker != nil && result.Verdict == VerdictOK {
+			if err := checkResult(ctx, checker, test, &result); err != nil {
+				return JobResult{Compile: compile}, err
+			}
+		}
+		// Runs that leaked, or whose memcheck report is incomplete, are not accepted
+		if job.RequireLeakFree && (result.Verdict == VerdictOK || result.Verdict == VerdictAccepted) && (result.Memcheck == nil || !result.Memcheck.LeakFree) {
+			result.Verdict = VerdictMemoryLeak
+		}
+		results = append(results, result)
+	}
+
+	jobResult := JobResult{Compile: compile, Results: results}
+	if job.Memcheck {
+		jobResult.LeakFree = leakFree(results)
+	}
+	return jobResult, nil
+}
+
+// testLimits returns the limits of the run of the test case, raised for memcheck jobs.
+func (j Job) testLimits(test TestCase) Limits {
+	limits := test.Limits.withDefaults(j.Limits)
+	if j.Memcheck {
+		limits.WallTime *= memcheckSlowdown
+		limits.CPUTime *= memcheckSlowdown
+	}
+	return limits
+}
+
+// budget returns the wall time the whole job may take: compiling the program and its checker or interactor, and running them for every test case.
+func (j Job) budget() time.Duration {
+	budget := DefaultCompileLimits.WallTime
+	helper := time.Duration(0) // Wall time of the checker or interactor on top of a run
+	switch {
+	case j.Checker != nil && j.Checker.Kind == CheckerCustom:
+		budget += DefaultCompileLimits.WallTime
+		helper = LimitsFor(j.Checker.Language).WallTime
+	case j.Interactor != nil:
+		budget += DefaultCompileLimits.WallTime
+		helper = interactorGrace
+	}
+
+	for _, test := range j.Tests {
+		budget += j.testLimits(test).WallTime + helper
+	}
+	return budget
+}
+
+// leakFree reports whether Valgrind found no leak in any of the runs.
+func leakFree(results []ExecutionResult) *bool {
+	free := true
+	for _, result := range results {
+		if result.Memcheck == nil || !result.Memcheck.LeakFree {
+			free = false
+		}
+	}
+	return &free
+}
+
+// setStatus reports the status of the job to its observer.
+func (j Job) setStatus(status JobStatus) {
+	if j.OnStatus != nil {
+		j.OnStatus(status)
+	}
+}
+
+// runWithInput runs the compiled program in the sandbox with the input streamed into its stdin.
+func runWithInput(ctx context.Context, runner Runner, sandbox *Sandbox, limits Limits, input Input) (ExecutionResult, error) {
+	stdin, err := input.Open()
+	if err != nil {
+		log.Printf("Failed to open input: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+	defer stdin.Close()
+
+	result, err := runner.Run(ctx, sandbox, stdin, limits)
+	if err != nil {
+		log.Printf("Failed to run program: %v", err)
+		return ExecutionResult{Verdict: VerdictInternalError}, err
+	}
+
+	return result, nil
+}
+
+// checkResult replaces the verdict of the run with the verdict of the checker.
+// Only a done context is returned as an error; any other checker failure marks the run as an internal error.
+func checkResult(ctx context.Context, checker Checker, test TestCase, result *ExecutionResult) error {
+	check, err := checker.Check(ctx, test.Input, result.Stdout, test.Expected)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Failed to check output: %v", err)
+		result.Verdict = VerdictInternalError
+		result.CheckerMessage = err.Error()
+		return nil
+	}
+
+	result.Verdict = check.Verdict
+	result.CheckerMessage = check.Message
+	return nil
+}
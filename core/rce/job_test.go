@@ -0,0 +1,269 @@
+package rce
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner compiles every program to the given compile result and runs it by calling run with the program and its input.
+type fakeRunner struct {
+	compile CompileResult
+	run     func(program string, input string) (ExecutionResult, error)
+
+	options  CompileOptions // Options of the last compilation
+	resets   int
+	cleanups int
+}
+
+func (f *fakeRunner) Compile(ctx context.Context, program string, language Language, files []File, opts CompileOptions) (*Sandbox, CompileResult, error) {
+	f.options = opts
+	return &Sandbox{ID: "fake", Language: language, Program: program, Files: files}, f.compile, nil
+}
+
+func (f *fakeRunner) Run(ctx context.Context, sandbox *Sandbox, stdin io.Reader, limits Limits) (ExecutionResult, error) {
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+	return f.run(sandbox.Program, string(input))
+}
+
+func (f *fakeRunner) AddFiles(ctx context.Context, sandbox *Sandbox, files []File) error {
+	return nil
+}
+
+func (f *fakeRunner) Reset(ctx context.Context, sandbox *Sandbox) error {
+	f.resets++
+	return nil
+}
+
+func (f *fakeRunner) Cleanup(sandbox *Sandbox) error {
+	f.cleanups++
+	return nil
+}
+
+// echo runs programs by printing their input.
+func echo(program string, input string) (ExecutionResult, error) {
+	return ExecutionResult{Stdout: input, Verdict: VerdictOK}, nil
+}
+
+// verdicts returns the verdict of every run of the job.
+func verdicts(result JobResult) []Verdict {
+	var verdicts []Verdict
+	for _, run := range result.Results {
+		verdicts = append(verdicts, run.Verdict)
+	}
+	return verdicts
+}
+
+func TestRunJobWith(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      Job
+		compile  CompileResult
+		run      func(program string, input string) (ExecutionResult, error)
+		verdicts []Verdict
+	}{
+		{
+			name: "unjudged",
+			job: Job{
+				Language: PYTHON,
+				Tests:    []TestCase{{Input: StringInput("1\n")}, {Input: StringInput("2\n")}},
+			},
+			run:      echo,
+			verdicts: []Verdict{VerdictOK, VerdictOK},
+		},
+		{
+			name: "checked",
+			job: Job{
+				Language: PYTHON,
+				Checker:  &CheckerSpec{Kind: CheckerExact},
+				Tests: []TestCase{
+					{Input: StringInput("1\n"), Expected: "1\n"},
+					{Input: StringInput("2\n"), Expected: "3\n"},
+					{Input: StringInput("crash"), Expected: "crash"},
+				},
+			},
+			run: func(program string, input string) (ExecutionResult, error) {
+				if input == "crash" {
+					return ExecutionResult{ExitCode: 1, Verdict: VerdictRuntimeError}, nil
+				}
+				return echo(program, input)
+			},
+			verdicts: []Verdict{VerdictAccepted, VerdictWrongAnswer, VerdictRuntimeError},
+		},
+		{
+			name: "compilation failed",
+			job: Job{
+				Language: C,
+				Tests:    []TestCase{{Input: StringInput("")}},
+			},
+			compile: CompileResult{Diagnostics: "main.c:1:1: error: expected identifier\n"},
+			run: func(program string, input string) (ExecutionResult, error) {
+				return ExecutionResult{}, errors.New("program ran although compilation failed")
+			},
+		},
+		{
+			name: "leak free required",
+			job: Job{
+				Language:        C,
+				Checker:         &CheckerSpec{Kind: CheckerExact},
+				RequireLeakFree: true,
+				Tests: []TestCase{
+					{Input: StringInput("free"), Expected: "free"},
+					{Input: StringInput("leak"), Expected: "leak"},
+					{Input: StringInput("killed"), Expected: "killed"},
+					{Input: StringInput("wrong"), Expected: "right"},
+				},
+			},
+			run: func(program string, input string) (ExecutionResult, error) {
+				result := ExecutionResult{Stdout: input, Verdict: VerdictOK}
+				switch input {
+				case "free", "wrong":
+					result.Memcheck = &MemcheckReport{LeakFree: true, Complete: true}
+				case "leak":
+					result.Memcheck = &MemcheckReport{Complete: true, LeakedBytes: 40}
+				}
+				return result, nil
+			},
+			verdicts: []Verdict{VerdictAccepted, VerdictMemoryLeak, VerdictMemoryLeak, VerdictWrongAnswer},
+		},
+		{
+			name: "function",
+			job: Job{
+				Program:  "def add(a, b):\n    return a + b\n",
+				Language: PYTHON,
+				Function: &FunctionSpec{Name: "add", Parameters: []Variable{{Name: "a", Type: TypeInt}, {Name: "b", Type: TypeInt}}, ReturnType: TypeInt},
+				Checker:  &CheckerSpec{Kind: CheckerExact},
+				Tests:    []TestCase{{Input: StringInput("1\n2\n"), Expected: "3\n"}},
+			},
+			run: func(program string, input string) (ExecutionResult, error) {
+				if !strings.Contains(program, "def add(a, b):") || program == "def add(a, b):\n    return a + b\n" {
+					return ExecutionResult{Verdict: VerdictRuntimeError}, nil
+				}
+				return ExecutionResult{Stdout: "3\n", Verdict: VerdictOK}, nil
+			},
+			verdicts: []Verdict{VerdictAccepted},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compile := test.compile
+			if compile.Diagnostics == "" {
+				compile.Success = true
+			}
+			runner := &fakeRunner{compile: compile, run: test.run}
+
+			var statuses []JobStatus
+			test.job.OnStatus = func(status JobStatus) { statuses = append(statuses, status) }
+
+			result, err := RunJobWith(context.Background(), runner, test.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := verdicts(result); !reflect.DeepEqual(got, test.verdicts) {
+				t.Fatalf("verdicts %v, want %v", got, test.verdicts)
+			}
+
+			if runner.cleanups != 1 {
+				t.Fatalf("sandbox cleaned up %d times", runner.cleanups)
+			}
+			if want := max(len(test.verdicts)-1, 0); runner.resets != want {
+				t.Fatalf("sandbox reset %d times, want %d", runner.resets, want)
+			}
+			if runner.options.Memcheck != test.job.RequireLeakFree {
+				t.Fatalf("compiled with memcheck %v", runner.options.Memcheck)
+			}
+			if test.job.RequireLeakFree && (result.LeakFree == nil || *result.LeakFree) {
+				t.Fatalf("job leak free %v, want false", result.LeakFree)
+			}
+
+			wantStatuses := []JobStatus{JobCompiling, JobRunning}
+			if !compile.Success {
+				wantStatuses = wantStatuses[:1]
+				if len(result.Compile.Messages) != 1 || result.Compile.Messages[0].Line != 1 {
+					t.Fatalf("compile messages %+v", result.Compile.Messages)
+				}
+			}
+			if !reflect.DeepEqual(statuses, wantStatuses) {
+				t.Fatalf("statuses %v, want %v", statuses, wantStatuses)
+			}
+		})
+	}
+}
+
+func TestRunJobWithRuntimeDiagnostics(t *testing.T) {
+	runner := &fakeRunner{
+		compile: CompileResult{Success: true},
+		run: func(program string, input string) (ExecutionResult, error) {
+			stderr := "Traceback (most recent call last):\n" +
+				"  File \"/workspace/main.py\", line 1, in <module>\n" +
+				"    print(1 // 0)\n" +
+				"ZeroDivisionError: integer division or modulo by zero\n"
+			return ExecutionResult{Stderr: stderr, ExitCode: 1, Verdict: VerdictRuntimeError}, nil
+		},
+	}
+
+	result, err := RunJobWith(context.Background(), runner, Job{
+		Program:  "print(1 // 0)\n",
+		Language: PYTHON,
+		Tests:    []TestCase{{Input: StringInput("")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Diagnostic{{File: "main.py", Line: 1, Severity: SeverityError, Message: "ZeroDivisionError: integer division or modulo by zero"}}
+	if got := result.Results[0].Diagnostics; !reflect.DeepEqual(got, want) {
+		t.Fatalf("diagnostics %+v, want %+v", got, want)
+	}
+}
+
+func TestRunJobWithErrors(t *testing.T) {
+	runFailed := errors.New("runner failed")
+
+	tests := []struct {
+		name string
+		job  Job
+		want error
+	}{
+		{
+			name: "checker and interactor",
+			job: Job{
+				Language:   PYTHON,
+				Checker:    &CheckerSpec{Kind: CheckerExact},
+				Interactor: &InteractorSpec{},
+			},
+		},
+		{
+			name: "unknown language",
+			job:  Job{Language: "cobol"},
+		},
+		{
+			name: "run failed",
+			job:  Job{Language: PYTHON, Tests: []TestCase{{Input: StringInput("")}}},
+			want: runFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := &fakeRunner{
+				compile: CompileResult{Success: true},
+				run: func(program string, input string) (ExecutionResult, error) {
+					return ExecutionResult{}, runFailed
+				},
+			}
+
+			_, err := RunJobWith(context.Background(), runner, test.job)
+			if err == nil || (test.want != nil && !errors.Is(err, test.want)) {
+				t.Fatalf("RunJobWith() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package rce
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits are the resource limits enforced on a single run of a program.
+type Limits struct {
+	WallTime    time.Duration // Real time before the program is killed
+	CPUTime     time.Duration // CPU time before the program is killed
+	OutputLimit int64         // Bytes captured from each of stdout and stderr before the program is killed
+}
+
+// DefaultLimits are the limits used when the caller does not provide any.
+var DefaultLimits = Limits{
+	WallTime:    10 * time.Second,
+	CPUTime:     5 * time.Second,
+	OutputLimit: 1 << 20, // 1MB
+}
+
+// DefaultCompileLimits are the limits the compiler runs under.
+var DefaultCompileLimits = Limits{
+	WallTime:    30 * time.Second,
+	CPUTime:     20 * time.Second,
+	OutputLimit: 1 << 20, // 1MB of diagnostics
+}
+
+// Resources are the resources of a sandbox, shared by every run in it.
+type Resources struct {
+	Memory    int64   // Bytes of memory
+	Processes int64   // Processes and threads
+	CPUShare  float64 // CPUs the sandbox may use, 0.5 is half of one
+}
+
+// DefaultResources are the resources of sandboxes that do not ask for others, unless their language needs more memory.
+var DefaultResources = Resources{
+	Memory:    MemoryLimit,
+	Processes: ProcessLimit,
+	CPUShare:  float64(CPUQuota) / CPUPeriod,
+}
+
+// withDefaults returns the resources with every zero field taken from the defaults.
+func (r Resources) withDefaults(defaults Resources) Resources {
+	if r.Memory == 0 {
+		r.Memory = defaults.Memory
+	}
+	if r.Processes == 0 {
+		r.Processes = defaults.Processes
+	}
+	if r.CPUShare == 0 {
+		r.CPUShare = defaults.CPUShare
+	}
+	return r
+}
+
+// cpuQuota returns the CPU share as a CFS quota for CPUPeriod.
+func (r Resources) cpuQuota() int64 {
+	return int64(r.CPUShare * CPUPeriod)
+}
+
+// QuestionLimits are the resource limits a question sets for its submissions, before the multipliers of the language.
+// Zero fields keep the defaults of the language.
+type QuestionLimits struct {
+	TimeMs    int64   `json:"timeMs,omitempty"` // CPU time of a run, the wall time is twice as long to allow for waiting on input
+	MemoryMB  int64   `json:"memoryMB,omitempty"`
+	Processes int64   `json:"processes,omitempty"`
+	OutputKB  int64   `json:"outputKB,omitempty"` // Of each of stdout and stderr
+	CPUShare  float64 `json:"cpuShare,omitempty"` // CPUs, 0.5 is half of one
+}
+
+// Bounds of the limits a question can set.
+const (
+	maxQuestionTime      = 60 * time.Second
+	minQuestionMemoryMB  = 6 // Docker does not allow less
+	maxQuestionMemoryMB  = 1024
+	maxQuestionProcesses = 1000
+	maxQuestionOutputKB  = 64 << 10
+	minQuestionCPUShare  = 0.01
+	maxQuestionCPUShare  = 4.0
+)
+
+// Validate checks that every limit set is within the bounds the engine allows.
+func (q QuestionLimits) Validate() error {
+	switch {
+	case q.TimeMs < 0 || time.Duration(q.TimeMs)*time.Millisecond > maxQuestionTime:
+		return fmt.Errorf("time limit must be at most %s", maxQuestionTime)
+	case q.MemoryMB != 0 && (q.MemoryMB < minQuestionMemoryMB || q.MemoryMB > maxQuestionMemoryMB):
+		return fmt.Errorf("memory limit must be between %dMB and %dMB", minQuestionMemoryMB, maxQuestionMemoryMB)
+	case q.Processes < 0 || q.Processes > maxQuestionProcesses:
+		return fmt.Errorf("process limit must be at most %d", maxQuestionProcesses)
+	case q.OutputKB < 0 || q.OutputKB > maxQuestionOutputKB:
+		return fmt.Errorf("output limit must be at most %dKB", maxQuestionOutputKB)
+	case q.CPUShare != 0 && (q.CPUShare < minQuestionCPUShare || q.CPUShare > maxQuestionCPUShare):
+		return fmt.Errorf("CPU share must be between %g and %g", minQuestionCPUShare, maxQuestionCPUShare)
+	}
+	return nil
+}
+
+// ForLanguage returns the run limits and the sandbox resources of submissions in the language:
+// the limits of the question scaled by the multipliers of the language, and its defaults for the limits the question does not set.
+func (q QuestionLimits) ForLanguage(language Language) (Limits, Resources) {
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		return DefaultLimits, DefaultResources
+	}
+
+	limits := spec.DefaultLimits()
+	resources := spec.DefaultResources()
+	timeMultiplier, memoryMultiplier := multiplier(spec.Limits.TimeMultiplier), multiplier(spec.Limits.MemoryMultiplier)
+
+	if q.TimeMs > 0 {
+		limits.CPUTime = time.Duration(float64(q.TimeMs)*timeMultiplier) * time.Millisecond
+		limits.WallTime = 2 * limits.CPUTime
+	}
+	if q.MemoryMB > 0 {
+		resources.Memory = int64(float64(q.MemoryMB<<20) * memoryMultiplier)
+	}
+	if q.Processes > 0 {
+		resources.Processes = q.Processes
+	}
+	if q.OutputKB > 0 {
+		limits.OutputLimit = q.OutputKB << 10
+	}
+	if q.CPUShare > 0 {
+		resources.CPUShare = q.CPUShare
+	}
+	return limits, resources
+}
+
+// multiplier returns the multiplier of a language, 1 when unset.
+func multiplier(m float64) float64 {
+	if m <= 0 {
+		return 1
+	}
+	return m
+}
+
+// withDefaults returns the limits with every zero field taken from the defaults.
+func (l Limits) withDefaults(defaults Limits) Limits {
+	if l.WallTime == 0 {
+		l.WallTime = defaults.WallTime
+	}
+	if l.CPUTime == 0 {
+		l.CPUTime = defaults.CPUTime
+	}
+	if l.OutputLimit == 0 {
+		l.OutputLimit = defaults.OutputLimit
+	}
+	return l
+}
+
+// cpuSeconds returns the CPU time limit rounded up to whole seconds, as required by rlimits.
+func (l Limits) cpuSeconds() int64 {
+	seconds := int64(l.CPUTime / time.Second)
+	if l.CPUTime%time.Second != 0 {
+		seconds++
+	}
+	return seconds
+}
+
+const exitCodeCPUTimeExceeded = exitCodeSignalBase + 24 // Exit status of a process killed by SIGXCPU
+
+// rlimitScript sets the CPU time rlimit and then replaces the shell with the command passed as arguments.
+// The soft limit raises SIGXCPU, the hard limit a second later SIGKILL in case it is ignored.
+const rlimitScript = "ulimit -S -t %d && ulimit -H -t %d && %sexec \"$@\""
+
+// rlimitCmd wraps the command in a shell that applies the CPU time limit and the extra ulimit statements.
+// The command is passed as positional arguments so user text never reaches the shell.
+func rlimitCmd(cmd []string, limits Limits, extra ...string) []string {
+	statements := ""
+	for _, statement := range extra {
+		statements += statement + " && "
+	}
+
+	script := fmt.Sprintf(rlimitScript, limits.cpuSeconds(), limits.cpuSeconds()+1, statements)
+	return append([]string{"sh", "-c", script, "sh"}, cmd...)
+}
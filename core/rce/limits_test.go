@@ -0,0 +1,79 @@
+package rce
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuestionLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits QuestionLimits
+		valid  bool
+	}{
+		{"none", QuestionLimits{}, true},
+		{"all set", QuestionLimits{TimeMs: 2000, MemoryMB: 64, Processes: 10, OutputKB: 512, CPUShare: 0.5}, true},
+		{"negative time", QuestionLimits{TimeMs: -1}, false},
+		{"time too long", QuestionLimits{TimeMs: 61000}, false},
+		{"memory below docker minimum", QuestionLimits{MemoryMB: 5}, false},
+		{"memory too large", QuestionLimits{MemoryMB: 2048}, false},
+		{"negative processes", QuestionLimits{Processes: -1}, false},
+		{"too many processes", QuestionLimits{Processes: 1001}, false},
+		{"output too large", QuestionLimits{OutputKB: 1 << 20}, false},
+		{"cpu share too small", QuestionLimits{CPUShare: 0.001}, false},
+		{"cpu share too large", QuestionLimits{CPUShare: 8}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.limits.Validate(); (err == nil) != test.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestQuestionLimitsForLanguage(t *testing.T) {
+	java, err := lookupLanguage(JAVA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		limits    QuestionLimits
+		language  Language
+		want      Limits
+		resources Resources
+	}{
+		{"defaults", QuestionLimits{}, C, DefaultLimits, DefaultResources},
+		{"language defaults", QuestionLimits{}, JAVA, java.DefaultLimits(), java.DefaultResources()},
+		{
+			"question limits",
+			QuestionLimits{TimeMs: 1500, MemoryMB: 64, Processes: 4, OutputKB: 8, CPUShare: 0.5},
+			C,
+			Limits{WallTime: 3 * time.Second, CPUTime: 1500 * time.Millisecond, OutputLimit: 8 << 10},
+			Resources{Memory: 64 << 20, Processes: 4, CPUShare: 0.5},
+		},
+		{
+			"scaled by the multipliers of the language",
+			QuestionLimits{TimeMs: 1000, MemoryMB: 64},
+			JAVA,
+			Limits{WallTime: 4 * time.Second, CPUTime: 2 * time.Second, OutputLimit: java.DefaultLimits().OutputLimit},
+			Resources{Memory: 128 << 20, Processes: ProcessLimit, CPUShare: DefaultResources.CPUShare},
+		},
+		{"unknown language", QuestionLimits{TimeMs: 1000}, "cobol", DefaultLimits, DefaultResources},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limits, resources := test.limits.ForLanguage(test.language)
+			if limits != test.want {
+				t.Fatalf("limits %+v, want %+v", limits, test.want)
+			}
+			if resources != test.resources {
+				t.Fatalf("resources %+v, want %+v", resources, test.resources)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package rce
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// memcheckReportFD is the file descriptor Valgrind writes its XML report to. Valgrind moves it out of reach of the program it runs,
+// so unlike a file in the workspace the program cannot forge the report.
+const memcheckReportFD = 3
+
+// maxMemcheckReportSize caps the bytes of a report that are read back, a longer report is cut and so not leak free.
+const maxMemcheckReportSize = 1 << 20
+
+// maxMemcheckRecords caps the leaks and the errors reported for a single run.
+const maxMemcheckRecords = 20
+
+// memcheckSlowdown is how many times the time limits are raised for runs under Valgrind, which run programs about that much slower.
+const memcheckSlowdown = 10
+
+// memcheckCmd runs the rest of the command under Valgrind memcheck, writing the report to memcheckReportFD.
+// The program keeps its own exit status. Still reachable blocks are not leaks, the C++ runtime keeps some until exit.
+var memcheckCmd = []string{
+	"valgrind",
+	"--tool=memcheck",
+	"--leak-check=full",
+	"--show-leak-kinds=definite,indirect,possible",
+	"--track-origins=yes",
+	"--vgdb=no",
+	"--xml=yes",
+	"--xml-fd=" + strconv.Itoa(memcheckReportFD),
+	"--",
+}
+
+// MemcheckReport is what Valgrind memcheck found during a run.
+type MemcheckReport struct {
+	LeakFree    bool             `json:"leakFree"`    // The run finished and nothing was definitely, indirectly or possibly lost
+	Complete    bool             `json:"complete"`    // Valgrind finished the report, false when the program was killed first
+	LeakedBytes int64            `json:"leakedBytes"` // Total of all leaks, including the ones left out of Leaks
+	Leaks       []MemcheckRecord `json:"leaks,omitempty"`
+	Errors      []MemcheckRecord `json:"errors,omitempty"` // Invalid reads, writes and frees, uses of uninitialised values, ...
+}
+
+// MemcheckRecord is a leak or an invalid access Valgrind memcheck reported.
+type MemcheckRecord struct {
+	Kind    string       `json:"kind"` // Valgrind error kind: Leak_DefinitelyLost, InvalidRead, UninitCondition, ...
+	Message string       `json:"message"`
+	Bytes   int64        `json:"bytes,omitempty"` // Leaked bytes, leaks only
+	File    string       `json:"file,omitempty"`  // Submission file the error happened or the leaked block was allocated in, if known
+	Line    int          `json:"line,omitempty"`
+	Stack   []StackFrame `json:"stack,omitempty"`
+}
+
+// memcheckError is an <error> of a Valgrind XML report.
+type memcheckError struct {
+	Kind  string `xml:"kind"`
+	What  string `xml:"what"`
+	XWhat struct {
+		Text        string `xml:"text"`
+		LeakedBytes int64  `xml:"leakedbytes"`
+	} `xml:"xwhat"`
+	AuxWhat []string `xml:"auxwhat"`
+	Stacks  []struct {
+		Frames []struct {
+			Function string `xml:"fn"`
+			File     string `xml:"file"`
+			Line     int    `xml:"line"`
+		} `xml:"frame"`
+	} `xml:"stack"`
+}
+
+// memcheckStderrFile is where the Docker runner sends the stderr of a program run under memcheck,
+// as the report takes the stderr stream of the exec.
+var memcheckStderrFile = path.Join(ScratchDir, ".stderr")
+
+// memcheckRedirectScript makes the stderr of the shell memcheckReportFD and sends stderr to the file named by the first argument,
+// then replaces the shell with the command passed as the remaining arguments.
+const memcheckRedirectScript = `exec 3>&2 2>"$0"; exec "$@"`
+
+// parseMemcheckReport reads the leaks and errors of a Valgrind XML report.
+// A report cut short by a killed program yields the records written so far. A missing, cut or malformed report,
+// or one followed by anything but whitespace, is not complete and so never leak free.
+func parseMemcheckReport(data []byte, files []File) MemcheckReport {
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+
+	var report MemcheckReport
+	leaked := false
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				report.Complete = false
+			}
+			break
+		}
+		if report.Complete {
+			if data, ok := token.(xml.CharData); !ok || len(bytes.TrimSpace(data)) > 0 {
+				report.Complete = false
+				break
+			}
+			continue
+		}
+
+		// The leak check comes last, so only a closed report is known to hold every leak
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == "valgrindoutput" {
+			report.Complete = true
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "error" {
+			continue
+		}
+
+		var e memcheckError
+		if err := decoder.DecodeElement(&e, &start); err != nil || e.Kind == "Leak_StillReachable" {
+			continue
+		}
+
+		record := newMemcheckRecord(e, names)
+		if strings.HasPrefix(e.Kind, "Leak_") {
+			leaked = true
+			report.LeakedBytes += e.XWhat.LeakedBytes
+			if len(report.Leaks) < maxMemcheckRecords {
+				report.Leaks = append(report.Leaks, record)
+			}
+		} else if len(report.Errors) < maxMemcheckRecords {
+			report.Errors = append(report.Errors, record)
+		}
+	}
+
+	report.LeakFree = report.Complete && !leaked
+	return report
+}
+
+// newMemcheckRecord converts an error of the report, placing it at the first frame in a submission file.
+func newMemcheckRecord(e memcheckError, names map[string]bool) MemcheckRecord {
+	record := MemcheckRecord{Kind: e.Kind, Message: e.What}
+	if e.XWhat.Text != "" {
+		record.Message = e.XWhat.Text
+		record.Bytes = e.XWhat.LeakedBytes
+	}
+	// Details like where a freed block was allocated
+	for _, aux := range e.AuxWhat {
+		record.Message += "\n" + aux
+	}
+
+	// Only the first stack is where the error happened
+	if len(e.Stacks) == 0 {
+		return record
+	}
+	for _, frame := range e.Stacks[0].Frames {
+		if frame.Function == "" {
+			continue
+		}
+
+		stackFrame := StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line}
+		if file := submissionFile(frame.File, names); file != "" {
+			stackFrame.File = file
+			if record.File == "" {
+				record.File, record.Line = file, frame.Line
+			}
+		}
+		record.Stack = append(record.Stack, stackFrame)
+	}
+	return record
+}
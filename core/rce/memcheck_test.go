@@ -0,0 +1,122 @@
+package rce
+
+import (
+	"reflect"
+	"testing"
+)
+
+// memcheckXML wraps the errors in a Valgrind XML report, closed unless the report was cut short.
+func memcheckXML(errors string, closed bool) string {
+	report := `<?xml version="1.0"?>
+<valgrindoutput>
+<protocolversion>4</protocolversion>
+<tool>memcheck</tool>
+` + errors
+	if closed {
+		report += "</valgrindoutput>\n"
+	}
+	return report
+}
+
+const memcheckLeakXML = `<error>
+  <unique>0x1</unique>
+  <kind>Leak_DefinitelyLost</kind>
+  <xwhat>
+    <text>40 bytes in 1 blocks are definitely lost in loss record 1 of 1</text>
+    <leakedbytes>40</leakedbytes>
+    <leakedblocks>1</leakedblocks>
+  </xwhat>
+  <stack>
+    <frame><ip>0x1</ip><fn>malloc</fn></frame>
+    <frame><ip>0x2</ip><fn>make</fn><dir>/workspace</dir><file>main.c</file><line>3</line></frame>
+    <frame><ip>0x3</ip><fn>main</fn><dir>/workspace</dir><file>main.c</file><line>8</line></frame>
+  </stack>
+</error>
+`
+
+const memcheckInvalidReadXML = `<error>
+  <unique>0x2</unique>
+  <kind>InvalidRead</kind>
+  <what>Invalid read of size 4</what>
+  <stack>
+    <frame><ip>0x4</ip><fn>main</fn><dir>/workspace</dir><file>main.c</file><line>6</line></frame>
+  </stack>
+  <auxwhat>Address 0x4a8c050 is 0 bytes after a block of size 16 alloc'd</auxwhat>
+</error>
+`
+
+const memcheckStillReachableXML = `<error>
+  <kind>Leak_StillReachable</kind>
+  <xwhat><text>72704 bytes in 1 blocks are still reachable</text><leakedbytes>72704</leakedbytes></xwhat>
+</error>
+`
+
+func TestParseMemcheckReport(t *testing.T) {
+	files := []File{{Name: "main.c"}}
+
+	leak := MemcheckRecord{
+		Kind:    "Leak_DefinitelyLost",
+		Message: "40 bytes in 1 blocks are definitely lost in loss record 1 of 1",
+		Bytes:   40,
+		File:    "main.c",
+		Line:    3,
+		Stack: []StackFrame{
+			{Function: "malloc"},
+			{Function: "make", File: "main.c", Line: 3},
+			{Function: "main", File: "main.c", Line: 8},
+		},
+	}
+	invalidRead := MemcheckRecord{
+		Kind:    "InvalidRead",
+		Message: "Invalid read of size 4\nAddress 0x4a8c050 is 0 bytes after a block of size 16 alloc'd",
+		File:    "main.c",
+		Line:    6,
+		Stack:   []StackFrame{{Function: "main", File: "main.c", Line: 6}},
+	}
+
+	tests := []struct {
+		name   string
+		report string
+		want   MemcheckReport
+	}{
+		{
+			name:   "leak free",
+			report: memcheckXML(memcheckStillReachableXML, true),
+			want:   MemcheckReport{LeakFree: true, Complete: true},
+		},
+		{
+			name:   "leak and invalid read",
+			report: memcheckXML(memcheckInvalidReadXML+memcheckLeakXML, true),
+			want:   MemcheckReport{Complete: true, LeakedBytes: 40, Leaks: []MemcheckRecord{leak}, Errors: []MemcheckRecord{invalidRead}},
+		},
+		{
+			name:   "cut short",
+			report: memcheckXML(memcheckInvalidReadXML, false),
+			want:   MemcheckReport{Errors: []MemcheckRecord{invalidRead}},
+		},
+		{
+			name:   "missing",
+			report: "",
+			want:   MemcheckReport{},
+		},
+		{
+			name:   "malformed",
+			report: memcheckXML("<error><kind>InvalidRead</kind>", false) + "</valgrindoutput>",
+			want:   MemcheckReport{},
+		},
+		{
+			name:   "forged report after the real one",
+			report: memcheckXML(memcheckLeakXML, true) + memcheckXML("", true),
+			want:   MemcheckReport{LeakedBytes: 40, Leaks: []MemcheckRecord{leak}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseMemcheckReport([]byte(test.report), files)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("parseMemcheckReport() =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package rce
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// errOutputLimitExceeded is returned by a limitedBuffer once the program wrote more than the limit.
+var errOutputLimitExceeded = errors.New("output limit exceeded")
+
+// limitedBuffer captures at most limit bytes of a stream and rejects anything past it.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+	onExceed func() // Called once when the limit is first crossed, if set
+}
+
+// newLimitedBuffer creates a buffer keeping at most limit bytes.
+func newLimitedBuffer(limit int64, onExceed func()) *limitedBuffer {
+	return &limitedBuffer{limit: limit, onExceed: onExceed}
+}
+
+// Write appends p up to the limit and fails with errOutputLimitExceeded once it is crossed.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errOutputLimitExceeded
+	}
+
+	remaining := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= remaining {
+		return b.buf.Write(p)
+	}
+
+	n, _ := b.buf.Write(p[:remaining])
+	b.exceeded = true
+	if b.onExceed != nil {
+		b.onExceed()
+	}
+	return n, errOutputLimitExceeded
+}
+
+// String returns the captured output.
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// Exceeded reports whether the program wrote more than the limit.
+func (b *limitedBuffer) Exceeded() bool {
+	return b.exceeded
+}
+
+// copyingWriter passes writes on to another writer until that writer fails, then drops them,
+// so a reader that went away never stops the output from being captured.
+type copyingWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (c *copyingWriter) Write(p []byte) (int, error) {
+	if !c.failed {
+		if _, err := c.w.Write(p); err != nil {
+			c.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// captureOutput returns the writer capturing a stream of the program into the buffer and copying what fits to w as it is written, if set.
+func captureOutput(buf *limitedBuffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, &copyingWriter{w: w})
+}
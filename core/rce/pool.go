@@ -0,0 +1,109 @@
+package rce
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Pool bounds the number of sandboxes alive at once, queueing excess jobs in arrival order.
+type Pool struct {
+	mu      sync.Mutex
+	size    int
+	running int
+	waiting []chan struct{} // FIFO of jobs waiting for a slot
+}
+
+// PoolStats is a snapshot of the load on a Pool.
+type PoolStats struct {
+	Size       int `json:"size"`
+	Running    int `json:"running"`
+	QueueDepth int `json:"queueDepth"`
+}
+
+var (
+	defaultPool   = NewPool(runtime.NumCPU())
+	defaultPoolMu sync.RWMutex
+)
+
+// NewPool creates a new Pool allowing size jobs to run at once.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{size: size}
+}
+
+// SetDefaultPool sets the pool that bounds RunProgramWith.
+func SetDefaultPool(pool *Pool) {
+	defaultPoolMu.Lock()
+	defer defaultPoolMu.Unlock()
+	defaultPool = pool
+}
+
+// DefaultPool returns the pool that bounds RunProgramWith.
+func DefaultPool() *Pool {
+	defaultPoolMu.RLock()
+	defer defaultPoolMu.RUnlock()
+	return defaultPool
+}
+
+// Acquire blocks until a slot is free or the context is done. Jobs are served in the order they called Acquire.
+// A job whose context is done leaves the queue without a slot and gets the context error.
+func (p *Pool) Acquire(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running < p.size && len(p.waiting) == 0 {
+		p.running++
+		p.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	p.waiting = append(p.waiting, ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	for i, waiting := range p.waiting {
+		if waiting == ready {
+			p.waiting = append(p.waiting[:i:i], p.waiting[i+1:]...)
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	p.mu.Unlock()
+
+	// The slot was handed over just as the context was done
+	p.Release()
+	return ctx.Err()
+}
+
+// Release frees the slot of a finished job, handing it to the oldest waiting job.
+func (p *Pool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.waiting) > 0 {
+		ready := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		close(ready) // The slot passes to the waiting job, running stays the same
+		return
+	}
+	p.running--
+}
+
+// Stats returns the current load on the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Size:       p.size,
+		Running:    p.running,
+		QueueDepth: len(p.waiting),
+	}
+}
@@ -0,0 +1,98 @@
+package rce
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForQueue waits until the pool has the given number of waiting jobs.
+func waitForQueue(t *testing.T, pool *Pool, depth int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats().QueueDepth != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth %d, want %d", pool.Stats().QueueDepth, depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolServesInArrivalOrder(t *testing.T) {
+	pool := NewPool(1)
+	ctx := context.Background()
+	if err := pool.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	const waiting = 3
+	order := make(chan int, waiting)
+	for i := 0; i < waiting; i++ {
+		go func() {
+			if err := pool.Acquire(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			pool.Release()
+		}()
+		waitForQueue(t, pool, i+1)
+	}
+
+	if stats := pool.Stats(); stats != (PoolStats{Size: 1, Running: 1, QueueDepth: waiting}) {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	pool.Release()
+	for i := 0; i < waiting; i++ {
+		if got := <-order; got != i {
+			t.Fatalf("job %d got the slot, want job %d", got, i)
+		}
+	}
+
+	waitForQueue(t, pool, 0)
+	if stats := pool.Stats(); stats.Running != 0 {
+		t.Fatalf("stats %+v after every job released its slot", stats)
+	}
+}
+
+func TestPoolCancelledAcquire(t *testing.T) {
+	pool := NewPool(1)
+	if err := pool.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() = %v, want the context error", err)
+	}
+	if stats := pool.Stats(); stats != (PoolStats{Size: 1, Running: 1}) {
+		t.Fatalf("stats %+v, want the cancelled job out of the queue", stats)
+	}
+
+	pool.Release()
+	if err := pool.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewPoolSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want int
+	}{
+		{-1, 1},
+		{0, 1},
+		{1, 1},
+		{8, 8},
+	}
+
+	for _, test := range tests {
+		if got := NewPool(test.size).Stats().Size; got != test.want {
+			t.Fatalf("NewPool(%d) has size %d, want %d", test.size, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package rce
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// processInitName is the name the server is started under, in the namespaces of a ProcessRunner sandbox,
+// to build the root file system of the sandbox before it runs the command.
+const processInitName = "rce-process-init"
+
+// processInitStatusFD is the descriptor processInit reports a failure to set up the sandbox on.
+// It is closed on exec, so the runner reads nothing from it once the command starts.
+const processInitStatusFD = memcheckReportFD + 1
+
+// processInitArgsEnd separates the arguments of processInit from the command it runs.
+const processInitArgsEnd = "--"
+
+// processRootSize is the size of the tmpfs at the root of a sandbox, which only holds mount points and symbolic links.
+const processRootSize = 1 << 20
+
+// Linux constants the syscall package does not define.
+const (
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+	capSysAdmin          = 21
+	rlimitNproc          = 6
+	statfsRelatime       = 0x1000 // ST_RELATIME, statfs reports the other mount flags with their MS_ values
+)
+
+// lockedMountFlags are the flags of a mount that a remount in a user namespace must keep.
+const lockedMountFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME
+
+// processDevices are the device files bound into the /dev of a sandbox.
+var processDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// processDeviceLinks are the symbolic links created in the /dev of a sandbox.
+var processDeviceLinks = map[string]string{
+	"/dev/fd":     "/proc/self/fd",
+	"/dev/stdin":  "/proc/self/fd/0",
+	"/dev/stdout": "/proc/self/fd/1",
+	"/dev/stderr": "/proc/self/fd/2",
+}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == processInitName {
+		processInit(os.Args[1:])
+	}
+}
+
+// processInitCmd returns the command that starts processInit to run the command in the workspace under the resources,
+// with the tmpfs of the root mounted on root and the toolchain bound read-only. Memory of zero is not limited.
+func processInitCmd(root, workspace string, resources Resources, toolchain []string, command []string) []string {
+	args := []string{processInitName, root, workspace, strconv.FormatInt(resources.Memory, 10), strconv.FormatInt(resources.Processes, 10)}
+	args = append(append(args, toolchain...), processInitArgsEnd)
+	return append(args, command...)
+}
+
+// processInit builds the root file system of the sandbox, makes it the root, drops the capabilities it was given and runs the command.
+// It never returns: a failure is written to processInitStatusFD and ends the process.
+func processInit(args []string) {
+	// Capabilities and no_new_privs belong to the thread, so everything up to exec runs on this one
+	runtime.LockOSThread()
+
+	syscall.CloseOnExec(processInitStatusFD)
+	status := os.NewFile(processInitStatusFD, "status")
+
+	err := runProcessInit(args)
+	fmt.Fprint(status, err)
+	os.Exit(1)
+}
+
+// runProcessInit runs the command of processInit, returning only if the sandbox cannot be set up.
+func runProcessInit(args []string) error {
+	end := -1
+	for i, arg := range args {
+		if arg == processInitArgsEnd {
+			end = i
+			break
+		}
+	}
+	if end < 4 || end == len(args)-1 {
+		return errors.New("usage: root workspace memory processes [toolchain...] -- command...")
+	}
+	root, workspace, toolchain, command := args[0], args[1], args[4:end], args[end+1:]
+	memory, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return err
+	}
+	processes, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if err := buildProcessRoot(root, workspace, toolchain); err != nil {
+		return err
+	}
+	if err := pivotRoot(root); err != nil {
+		return err
+	}
+	if err := os.Chdir(WorkspaceDir); err != nil {
+		return fmt.Errorf("failed to enter workspace: %w", err)
+	}
+
+	// The command runs as the sandbox user with no capabilities and cannot gain any
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("failed to set no_new_privs: %w", errno)
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	// Set last, as the threads of this process count as processes until exec
+	if err := setProcessRlimits(memory, processes); err != nil {
+		return err
+	}
+	return syscall.Exec(path, command, os.Environ())
+}
+
+// setProcessRlimits limits the data of the process to memory bytes, unless it is zero,
+// and the processes and threads of the sandbox user to processes, which only this sandbox has in its user namespace.
+func setProcessRlimits(memory, processes int64) error {
+	if memory > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: uint64(memory), Max: uint64(memory)}); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+
+	limit := syscall.Rlimit{Cur: uint64(processes), Max: uint64(processes)}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, 0, rlimitNproc, uintptr(unsafe.Pointer(&limit)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to limit processes: %w", errno)
+	}
+	return nil
+}
+
+// buildProcessRoot mounts a tmpfs on root and fills it with the toolchain bound read-only, the workspace,
+// a scratch space, a few devices and the proc file system of the PID namespace.
+// Toolchain paths that do not exist on the host are left out.
+func buildProcessRoot(root, workspace string, toolchain []string) error {
+	// Nothing mounted from now on propagates back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, fmt.Sprintf("size=%d,mode=0755", processRootSize)); err != nil {
+		return fmt.Errorf("failed to mount root: %w", err)
+	}
+
+	for _, path := range toolchain {
+		if err := bindToolchainPath(root, path); err != nil {
+			return err
+		}
+	}
+
+	if err := bindMount(workspace, filepath.Join(root, WorkspaceDir), syscall.MS_NOSUID|syscall.MS_NODEV); err != nil {
+		return err
+	}
+
+	scratch := filepath.Join(root, ScratchDir)
+	if err := os.MkdirAll(scratch, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", scratch, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, fmt.Sprintf("size=%d,mode=1777", ScratchSize)); err != nil {
+		return fmt.Errorf("failed to mount scratch space: %w", err)
+	}
+
+	for _, device := range processDevices {
+		if err := bindMount(device, filepath.Join(root, device), syscall.MS_NOSUID|syscall.MS_NOEXEC); err != nil {
+			return err
+		}
+	}
+	for link, target := range processDeviceLinks {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			return err
+		}
+	}
+
+	proc := filepath.Join(root, "proc")
+	if err := os.MkdirAll(proc, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount proc: %w", err)
+	}
+	return nil
+}
+
+// bindToolchainPath binds the toolchain path read-only to the same path under root, or copies it if it is a symbolic link.
+func bindToolchainPath(root, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, path)
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	}
+	return bindMount(path, target, syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV)
+}
+
+// bindMount binds the file or directory at source to target, creating target, and remounts it with the flags.
+// The remount keeps the flags of the mount of source that a user namespace cannot clear.
+func bindMount(source, target string, flags uintptr) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else {
+		err = createMountPoint(target)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind %s: %w", source, err)
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(target, &stat); err != nil {
+		return err
+	}
+	locked := uintptr(stat.Flags) & lockedMountFlags
+	if stat.Flags&statfsRelatime != 0 {
+		locked |= syscall.MS_RELATIME
+	}
+	if err := syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|flags|locked, ""); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", source, err)
+	}
+	return nil
+}
+
+// createMountPoint creates an empty file to bind a file to.
+func createMountPoint(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// pivotRoot makes root the root of the mount namespace, detaches the old root and makes the new one read-only.
+func pivotRoot(root string) error {
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	// Stacks the old root on top of the new one, so it can be detached without a directory to put it in
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot root: %w", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach old root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("failed to make root read-only: %w", err)
+	}
+	return nil
+}
+
+// processToolchainPaths expands the glob patterns of the toolchain into the paths that exist on the host.
+func processToolchainPaths(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("toolchain path is not absolute: %s", pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
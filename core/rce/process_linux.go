@@ -0,0 +1,411 @@
+package rce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const ProcessFileSizeLimit = 20480 // 10MB in 512 byte blocks
+
+// DefaultProcessToolchain are the paths of the host, as glob patterns, bound read-only into the root of ProcessRunner sandboxes:
+// the compilers, runtimes and libraries of the languages and the configuration of the dynamic linker and the JVM.
+var DefaultProcessToolchain = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/java-*",
+}
+
+// ProcessRunner runs programs as local processes isolated with Linux namespaces and rlimits.
+// Every run gets its own root file system holding the workspace, a scratch space and the toolchain of the host read-only,
+// and runs as the sandbox user without capabilities. The memory and the processes of the sandbox are enforced with rlimits,
+// so memory counts the data of the program rather than its resident memory; there is no CPU share.
+type ProcessRunner struct {
+	root      string   // Empty directory the root of every sandbox is mounted on, in the mount namespace of the sandbox
+	toolchain []string // Paths of the host bound read-only into the root
+	uid, gid  int      // Host user and group the sandbox user maps to
+
+	mu       sync.Mutex
+	versions map[Language]string // Output of the version command of every language used so far
+}
+
+// NewProcessRunner creates a new ProcessRunner with DefaultProcessToolchain.
+func NewProcessRunner() (*ProcessRunner, error) {
+	toolchain, err := processToolchainPaths(DefaultProcessToolchain)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := os.MkdirTemp("", "code-runner-root-")
+	if err != nil {
+		log.Printf("Failed to create sandbox root: %v", err)
+		return nil, err
+	}
+	// The sandbox user has to reach the directory to mount on it
+	if err := os.Chmod(root, 0755); err != nil {
+		log.Printf("Failed to create sandbox root: %v", err)
+		os.Remove(root)
+		return nil, err
+	}
+
+	// The process limit does not hold for root, so a server running as root maps the sandbox user to nobody
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = sandboxUserID, sandboxUserID
+	}
+
+	return &ProcessRunner{root: root, toolchain: toolchain, uid: uid, gid: gid, versions: map[Language]string{}}, nil
+}
+
+// Compile creates the private working directory, writes the files into it and runs the compiler there.
+// A cached artifact of the same files and toolchain is restored instead of compiling again.
+func (p *ProcessRunner) Compile(ctx context.Context, program string, language Language, files []File, opts CompileOptions) (*Sandbox, CompileResult, error) {
+	spec, err := lookupCompileSpec(language, opts)
+	if err != nil {
+		return nil, CompileResult{}, err
+	}
+
+	all, err := sandboxFiles(spec, program, files)
+	if err != nil {
+		return nil, CompileResult{}, err
+	}
+
+	key, cached, snapshot, hit, err := lookupArtifact(spec, all, func() (string, error) {
+		return p.toolchainVersion(ctx, spec)
+	})
+	if err != nil {
+		log.Printf("Failed to look up cached artifact: %v", err)
+		return nil, CompileResult{}, err
+	}
+
+	workDir, err := os.MkdirTemp("", string(spec.ID)+"-code-runner-")
+	if err != nil {
+		log.Printf("Failed to create working directory: %v", err)
+		return nil, CompileResult{}, err
+	}
+
+	sandbox := &Sandbox{
+		ID:       workDir,
+		Language: language,
+		Program:  program,
+		Files:    all,
+		spec:     spec,
+		options:  opts,
+	}
+
+	// The cached working directory holds the files and the artifact
+	if hit {
+		if err := p.restoreWorkspace(workDir, snapshot); err != nil {
+			log.Printf("Failed to restore cached artifact: %v", err)
+			os.RemoveAll(workDir)
+			return nil, CompileResult{}, err
+		}
+		sandbox.snapshot = snapshot
+		return sandbox, cached, nil
+	}
+
+	if err := p.writeWorkspace(workDir, all); err != nil {
+		log.Printf("Failed to write files: %v", err)
+		os.RemoveAll(workDir)
+		return nil, CompileResult{}, err
+	}
+
+	compile := CompileResult{Success: true}
+	if spec.CompileCmd != nil {
+		// Like in a container, the compiler gets more memory than the programs it builds
+		resources := opts.resources(spec)
+		resources.Memory = max(resources.Memory, CompileMemoryLimit)
+
+		result, err := p.execute(ctx, sandbox, spec.CompileCmd, strings.NewReader(""), DefaultCompileLimits, resources, nil)
+		if err != nil {
+			log.Printf("Failed to run compiler: %v", err)
+			os.RemoveAll(workDir)
+			return nil, CompileResult{}, err
+		}
+		compile = newCompileResult(result)
+	}
+
+	// Every run starts from the working directory as the compiler left it
+	if compile.Success {
+		sandbox.snapshot, err = archiveDir(workDir)
+		if err != nil {
+			log.Printf("Failed to snapshot working directory: %v", err)
+			os.RemoveAll(workDir)
+			return nil, CompileResult{}, err
+		}
+		storeArtifact(key, compile, sandbox.snapshot)
+	}
+
+	return sandbox, compile, nil
+}
+
+// Run executes the compiled artifact under the limits.
+func (p *ProcessRunner) Run(ctx context.Context, sandbox *Sandbox, stdin io.Reader, limits Limits) (ExecutionResult, error) {
+	var report *limitedBuffer
+	if sandbox.options.Memcheck {
+		report = newLimitedBuffer(maxMemcheckReportSize, nil)
+	}
+
+	result, err := p.execute(ctx, sandbox, sandbox.runCmd(), stdin, limits, sandbox.options.resources(sandbox.spec), report)
+	if err != nil {
+		return result, err
+	}
+
+	if report != nil {
+		memcheck := parseMemcheckReport([]byte(report.String()), sandbox.Files)
+		result.Memcheck = &memcheck
+	}
+	return sandbox.withFindings(result), nil
+}
+
+// AddFiles writes the files into the working directory.
+func (p *ProcessRunner) AddFiles(ctx context.Context, sandbox *Sandbox, files []File) error {
+	if err := validateFiles(files); err != nil {
+		return err
+	}
+
+	if err := p.writeWorkspace(sandbox.ID, files); err != nil {
+		log.Printf("Failed to write files: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Reset restores the working directory from the snapshot taken after compilation.
+// Nothing else outlives a run as its processes die with its PID namespace.
+func (p *ProcessRunner) Reset(ctx context.Context, sandbox *Sandbox) error {
+	if err := p.restoreWorkspace(sandbox.ID, sandbox.snapshot); err != nil {
+		log.Printf("Failed to restore working directory: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the working directory.
+func (p *ProcessRunner) Cleanup(sandbox *Sandbox) error {
+	if err := os.RemoveAll(sandbox.ID); err != nil {
+		log.Printf("Failed to remove working directory: %v", err)
+		return err
+	}
+	return nil
+}
+
+// writeWorkspace writes the files into the workspace and gives them to the sandbox user.
+func (p *ProcessRunner) writeWorkspace(dir string, files []File) error {
+	if err := writeFiles(dir, files); err != nil {
+		return err
+	}
+	return p.chownWorkspace(dir)
+}
+
+// restoreWorkspace restores the workspace from the archive and gives it to the sandbox user.
+func (p *ProcessRunner) restoreWorkspace(dir string, archive []byte) error {
+	if err := restoreDir(dir, archive); err != nil {
+		return err
+	}
+	return p.chownWorkspace(dir)
+}
+
+// chownWorkspace gives the workspace and everything in it to the host user the sandbox user maps to, if the server is not that user.
+func (p *ProcessRunner) chownWorkspace(dir string) error {
+	if p.uid == os.Getuid() && p.gid == os.Getgid() {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, p.uid, p.gid)
+	})
+}
+
+// toolchainVersion returns the output of the version command of the language, running it only the first time.
+// It is empty when the language has no version command.
+func (p *ProcessRunner) toolchainVersion(ctx context.Context, spec LanguageSpec) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if version, ok := p.versions[spec.ID]; ok {
+		return version, nil
+	}
+	if spec.VersionCmd == nil {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultCompileLimits.WallTime)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, spec.VersionCmd[0], spec.VersionCmd[1:]...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", spec.ID, err)
+	}
+
+	p.versions[spec.ID] = string(output)
+	return p.versions[spec.ID], nil
+}
+
+// execute runs the command in the workspace in new user, mount, PID, network, IPC and UTS namespaces under the limits and the resources.
+// The process is killed once the wall time is up or the context is done.
+// Debug builds get no data limit as AddressSanitizer reserves terabytes of shadow memory and Valgrind reserves its own.
+// When report is set the command gets the write end of a pipe as memcheckReportFD, and what it writes there is captured in report.
+func (p *ProcessRunner) execute(parent context.Context, sandbox *Sandbox, command []string, stdin io.Reader, limits Limits, resources Resources, report *limitedBuffer) (ExecutionResult, error) {
+	if sandbox.options.debug() {
+		resources.Memory = 0
+	}
+	args := processInitCmd(p.root, sandbox.ID, resources, p.toolchain, rlimitCmd(command, limits, fmt.Sprintf("ulimit -f %d", ProcessFileSizeLimit)))
+
+	ctx, cancel := context.WithTimeout(parent, limits.WallTime)
+	defer cancel()
+
+	// Killing the first process of the PID namespace kills every process in it
+	// processInit is the server itself started under another name
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = args
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + WorkspaceDir}, sandbox.spec.Env...)
+	cmd.SysProcAttr = newProcessSysProcAttr(p.uid, p.gid)
+	cmd.WaitDelay = time.Second
+
+	// Kill the program as soon as it crosses the output limit rather than letting it block on a full pipe
+	killOnExceed := func() { cmd.Process.Kill() }
+	stdout := newLimitedBuffer(limits.OutputLimit, killOnExceed)
+	stderr := newLimitedBuffer(limits.OutputLimit, killOnExceed)
+	cmd.Stdout = captureOutput(stdout, sandbox.stdout)
+	cmd.Stderr = stderr
+	stdinPipe, err := cmd.StdinPipe()
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+
+	// processInit reports a sandbox it could not set up on the status pipe, which closes unread once the command starts
+	statusReader, statusWriter, err := os.Pipe()
+	if err != nil {
+		log.Printf("Failed to create sandbox status pipe: %v", err)
+		return ExecutionResult{}, err
+	}
+	defer statusReader.Close()
+	defer statusWriter.Close()
+
+	var reportWriter *os.File
+	reportDone := make(chan struct{})
+	if report != nil {
+		var reportReader *os.File
+		reportReader, reportWriter, err = os.Pipe()
+		if err != nil {
+			log.Printf("Failed to create memcheck report pipe: %v", err)
+			return ExecutionResult{}, err
+		}
+		defer reportReader.Close()
+		defer reportWriter.Close()
+
+		go func() {
+			// A report longer than its buffer is cut rather than stopping the program
+			io.Copy(&copyingWriter{w: report}, reportReader)
+			close(reportDone)
+		}()
+	} else {
+		close(reportDone)
+	}
+	// The first extra file is descriptor 3, memcheckReportFD, and is closed without a report
+	cmd.ExtraFiles = []*os.File{reportWriter, statusWriter}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start process: %v", err)
+		return ExecutionResult{}, err
+	}
+	statusWriter.Close()
+	if reportWriter != nil {
+		// Once the processes of the sandbox hold the only write end, the report ends when they exit
+		reportWriter.Close()
+	}
+
+	failure, err := io.ReadAll(statusReader)
+	if err == nil && len(failure) > 0 {
+		err = errors.New(string(failure))
+	}
+	if err != nil {
+		log.Printf("Failed to set up sandbox: %v", err)
+		cmd.Process.Kill()
+		cmd.Wait()
+		return ExecutionResult{}, fmt.Errorf("failed to set up sandbox: %w", err)
+	}
+
+	// Not waited for, so an input that outlives the program, like the output of an interactor, cannot hold up the run
+	go func() {
+		io.Copy(stdinPipe, stdin)
+		stdinPipe.Close()
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		// A non-zero exit status or too much output is a result of the program, not a failure of the runner
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) && !errors.Is(err, errOutputLimitExceeded) {
+			log.Printf("Failed to wait for process: %v", err)
+			return ExecutionResult{}, err
+		}
+	}
+	wallTime := time.Since(start)
+	<-reportDone
+
+	if err := parent.Err(); err != nil {
+		return ExecutionResult{}, err
+	}
+
+	state := cmd.ProcessState
+	status, _ := state.Sys().(syscall.WaitStatus)
+	rusage, _ := state.SysUsage().(*syscall.Rusage)
+
+	result := ExecutionResult{
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		ExitCode:        status.ExitStatus(),
+		Signal:          signalFromExitCode(status.ExitStatus()),
+		WallTime:        wallTime,
+		CPUTime:         state.UserTime() + state.SystemTime(),
+		OutputTruncated: stdout.Exceeded() || stderr.Exceeded(),
+	}
+	if status.Signaled() {
+		result.ExitCode = exitCodeSignalBase + int(status.Signal())
+		result.Signal = int(status.Signal())
+	}
+	if rusage != nil {
+		result.PeakMemory = rusage.Maxrss * 1024 // Maxrss is in KB
+	}
+
+	timedOut := ctx.Err() == context.DeadlineExceeded || result.CPUTime >= limits.CPUTime || result.ExitCode == exitCodeCPUTimeExceeded
+	result.Verdict = newVerdict(result, timedOut)
+
+	return result, nil
+}
+
+// newProcessSysProcAttr returns the namespace configuration for a sandboxed process whose user maps to the host user and group.
+func newProcessSysProcAttr(uid, gid int) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER |
+			syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | // No network interfaces besides loopback
+			syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxUserID, HostID: uid, Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxUserID, HostID: gid, Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+		Credential:                 &syscall.Credential{Uid: sandboxUserID, Gid: sandboxUserID, NoSetGroups: true},
+		AmbientCaps:                []uintptr{capSysAdmin}, // For processInit to mount the root, it clears them before running the command
+		Pdeathsig:                  syscall.SIGKILL,
+		Setpgid:                    true,
+	}
+}
@@ -0,0 +1,269 @@
+package rce
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestProcessRunner returns a process runner, skipping the test when gcc or the namespaces of the sandbox are not available.
+func newTestProcessRunner(t *testing.T) *ProcessRunner {
+	t.Helper()
+
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc is not installed")
+	}
+	runner, err := NewProcessRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(runner.root) })
+
+	sandbox, _, err := runner.Compile(context.Background(), "int main(void) { return 0; }", C, nil, CompileOptions{})
+	if err != nil {
+		t.Skipf("the process sandbox is not available: %v", err)
+	}
+	runner.Cleanup(sandbox)
+	return runner
+}
+
+// processIsolationProgram reports what a program can reach from inside the sandbox.
+// Its first argument is a directory of the host outside the toolchain.
+const processIsolationProgram = `#include <stdio.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+int main(int argc, char **argv) {
+	char path[4096];
+	snprintf(path, sizeof path, "%s/process_linux.go", argv[1]);
+	printf("host file visible: %d\n", access(path, F_OK) == 0);
+	printf("toolchain writable: %d\n", fopen("/usr/sandbox", "w") != NULL);
+	printf("workspace writable: %d\n", fopen("out.txt", "w") != NULL);
+	printf("uid: %d\n", (int)getuid());
+
+	unsigned long long capabilities = 1;
+	char line[256];
+	FILE *status = fopen("/proc/self/status", "r");
+	while (status != NULL && fgets(line, sizeof line, status) != NULL) {
+		sscanf(line, "CapEff: %llx", &capabilities);
+	}
+	printf("capabilities: %d\n", capabilities != 0);
+
+	int children = 0;
+	for (int i = 0; i < 20; i++) {
+		pid_t pid = fork();
+		if (pid < 0) {
+			break;
+		}
+		if (pid == 0) {
+			pause();
+			_exit(0);
+		}
+		children++;
+	}
+	printf("children: %d\n", children);
+	printf("allocated: %d\n", malloc(64 << 20) != NULL);
+	return 0;
+}
+`
+
+func TestProcessRunnerIsolation(t *testing.T) {
+	runner := newTestProcessRunner(t)
+	ctx := context.Background()
+
+	hostDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox, compile, err := runner.Compile(ctx, processIsolationProgram, C, nil, CompileOptions{Resources: Resources{Memory: 32 << 20, Processes: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Cleanup(sandbox)
+	if !compile.Success {
+		t.Fatalf("compilation failed: %s", compile.Diagnostics)
+	}
+	sandbox.Args = []string{hostDir}
+
+	result, err := runner.Run(ctx, sandbox, strings.NewReader(""), DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The process limit leaves room for the program and a few children
+	want := "host file visible: 0\ntoolchain writable: 0\nworkspace writable: 1\nuid: 65534\ncapabilities: 0\nchildren: 4\nallocated: 0\n"
+	if result.Verdict != VerdictOK || result.Stdout != want {
+		t.Fatalf("verdict %s, stdout %q, stderr %q, want stdout %q", result.Verdict, result.Stdout, result.Stderr, want)
+	}
+}
+
+func TestProcessRunnerReset(t *testing.T) {
+	runner := newTestProcessRunner(t)
+	ctx := context.Background()
+
+	// Every run reports whether a previous one left its file in the workspace
+	program := `#include <stdio.h>
+#include <unistd.h>
+
+int main(void) {
+	printf("%d\n", access("leftover", F_OK) == 0);
+	fclose(fopen("leftover", "w"));
+	return 0;
+}
+`
+	sandbox, compile, err := runner.Compile(ctx, program, C, nil, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Cleanup(sandbox)
+	if !compile.Success {
+		t.Fatalf("compilation failed: %s", compile.Diagnostics)
+	}
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			if err := runner.Reset(ctx, sandbox); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result, err := runner.Run(ctx, sandbox, strings.NewReader(""), DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Verdict != VerdictOK || result.Stdout != "0\n" {
+			t.Fatalf("run %d: verdict %s, stdout %q, stderr %q", i, result.Verdict, result.Stdout, result.Stderr)
+		}
+	}
+}
+
+func TestProcessRunnerSetupFailure(t *testing.T) {
+	runner := newTestProcessRunner(t)
+	ctx := context.Background()
+
+	sandbox, _, err := runner.Compile(ctx, "int main(void) { return 0; }", C, nil, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Cleanup(sandbox)
+
+	// A sandbox whose root cannot be mounted is a failure of the runner, not a result of the program
+	runner.root = sandbox.ID + "/missing"
+	if _, err := runner.Run(ctx, sandbox, strings.NewReader(""), DefaultLimits); err == nil || !strings.Contains(err.Error(), "failed to set up sandbox") {
+		t.Fatalf("Run() = %v, want a sandbox setup failure", err)
+	}
+}
+
+func TestRunJobWithCustomChecker(t *testing.T) {
+	runner := newTestProcessRunner(t)
+
+	// Accepts an output whose number is the expected one, reporting a wrong answer otherwise
+	checker := `#include <stdio.h>
+
+int main(int argc, char **argv) {
+	long long output, answer;
+	FILE *out = fopen(argv[2], "r"), *ans = fopen(argv[3], "r");
+	if (out == NULL || ans == NULL || fscanf(ans, "%lld", &answer) != 1) {
+		fprintf(stderr, "cannot read files");
+		return 3;
+	}
+	if (fscanf(out, "%lld", &output) != 1 || output != answer) {
+		fprintf(stderr, "wrong number");
+		return 1;
+	}
+	return 0;
+}
+`
+	result, err := RunJobWith(context.Background(), runner, Job{
+		Program:  "#include <stdio.h>\n\nint main(void) {\n\tlong long n;\n\tscanf(\"%lld\", &n);\n\tprintf(\"%lld\\n\", 2 * n);\n\treturn 0;\n}",
+		Language: C,
+		Limits:   DefaultLimits,
+		Tests: []TestCase{
+			{Input: StringInput("2\n"), Expected: "4"},
+			{Input: StringInput("3\n"), Expected: "7"},
+		},
+		Checker: &CheckerSpec{Kind: CheckerCustom, Program: checker, Language: C},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := verdicts(result), []Verdict{VerdictAccepted, VerdictWrongAnswer}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("verdicts %v, want %v: %+v", got, want, result)
+	}
+	if message := result.Results[1].CheckerMessage; message != "wrong number" {
+		t.Fatalf("checker message %q, want %q", message, "wrong number")
+	}
+}
+
+func TestRunJobWithInteractor(t *testing.T) {
+	runner := newTestProcessRunner(t)
+
+	// Answers guesses of the secret number in the input until it is found, within 10 guesses
+	interactor := `#include <stdio.h>
+
+int main(int argc, char **argv) {
+	int secret, guess;
+	FILE *in = fopen(argv[1], "r");
+	if (in == NULL || fscanf(in, "%d", &secret) != 1) {
+		return 3;
+	}
+	for (int i = 0; i < 10 && scanf("%d", &guess) == 1; i++) {
+		printf("%s\n", guess < secret ? "higher" : guess > secret ? "lower" : "found");
+		fflush(stdout);
+		if (guess == secret) {
+			return 0;
+		}
+	}
+	fprintf(stderr, "secret not found");
+	return 1;
+}
+`
+	// Searches 1 to 100, giving up once the range is empty
+	program := `#include <stdio.h>
+#include <string.h>
+
+int main(void) {
+	char reply[16];
+	for (int lo = 1, hi = 100; lo <= hi;) {
+		int guess = (lo + hi) / 2;
+		printf("%d\n", guess);
+		fflush(stdout);
+		if (scanf("%15s", reply) != 1 || strcmp(reply, "found") == 0) {
+			break;
+		}
+		if (strcmp(reply, "higher") == 0) {
+			lo = guess + 1;
+		} else {
+			hi = guess - 1;
+		}
+	}
+	return 0;
+}
+`
+	result, err := RunJobWith(context.Background(), runner, Job{
+		Program:    program,
+		Language:   C,
+		Limits:     DefaultLimits,
+		Tests:      []TestCase{{Input: StringInput("37\n")}, {Input: StringInput("200\n")}},
+		Interactor: &InteractorSpec{Program: interactor, Language: C},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := verdicts(result), []Verdict{VerdictAccepted, VerdictWrongAnswer}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("verdicts %v, want %v: %+v", got, want, result)
+	}
+	first := result.Results[0].Transcript
+	if len(first) == 0 || first[0].From != transcriptProgram || first[0].Data != "50\n" {
+		t.Fatalf("transcript starts with %+v, want the first guess of the program", first)
+	}
+	if message := result.Results[1].CheckerMessage; message != "secret not found" {
+		t.Fatalf("interactor message %q, want %q", message, "secret not found")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package rce
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ProcessRunner is only available on Linux.
+type ProcessRunner struct{}
+
+// NewProcessRunner reports that the process sandbox is not supported on this platform.
+func NewProcessRunner() (*ProcessRunner, error) {
+	return nil, fmt.Errorf("process runner requires Linux namespaces")
+}
+
+func (p *ProcessRunner) Compile(ctx context.Context, program string, language Language, files []File, opts CompileOptions) (*Sandbox, CompileResult, error) {
+	return nil, CompileResult{}, fmt.Errorf("process runner requires Linux namespaces")
+}
+
+func (p *ProcessRunner) Run(ctx context.Context, sandbox *Sandbox, stdin io.Reader, limits Limits) (ExecutionResult, error) {
+	return ExecutionResult{}, fmt.Errorf("process runner requires Linux namespaces")
+}
+
+func (p *ProcessRunner) AddFiles(ctx context.Context, sandbox *Sandbox, files []File) error {
+	return fmt.Errorf("process runner requires Linux namespaces")
+}
+
+func (p *ProcessRunner) Reset(ctx context.Context, sandbox *Sandbox) error {
+	return fmt.Errorf("process runner requires Linux namespaces")
+}
+
+func (p *ProcessRunner) Cleanup(sandbox *Sandbox) error {
+	return fmt.Errorf("process runner requires Linux namespaces")
+}
@@ -1,18 +1,15 @@
 package rce
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	"log"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
+	"strings"
 )
 
+// Language is the identifier of a language in the registry.
 type Language string
 
+// Identifiers of the built-in languages.
 const (
 	PYTHON Language = "python"
 	JAVA   Language = "java"
@@ -21,164 +18,71 @@ const (
 )
 
 const (
-	MemoryLimit = 10000000 // 10MB (Minimum memory limit allowed is 6MB by Docker)
-	CPUQuota    = 100000   // 0.1 CPU
+	MemoryLimit        = 10000000  // 10MB (Minimum memory limit allowed is 6MB by Docker)
+	DebugMemoryLimit   = 256000000 // 256MB, the sanitizer runtimes and Valgrind alone use more than MemoryLimit
+	CompileMemoryLimit = 512000000 // 512MB, compilers like g++ and javac need much more than the programs they build
+	CPUQuota           = 100000    // Microseconds of CPU time per CPUPeriod
+	CPUPeriod          = 100000    // 100ms, the default CFS period of Docker
+	ProcessLimit       = 100       // Processes and threads of a sandbox
 )
 
-// RunProgram runs the given program in a Docker container with the specified language.
-func RunProgram(program string, language Language) (string, string, error) {
-	containerImage, cmd, containerName, err := getContainerConfig(program, language)
-	if err != nil {
-		return "", "", err
-	}
-
-	ctx := context.Background()
-
-	apiClient, err := createNewAPIClient()
-	if err != nil {
-		log.Printf("Failed to create Docker client: %v", err)
-		return "", "", err
-	}
-
-	resp, err := createContainer(ctx, apiClient, containerImage, cmd, containerName)
-	if err != nil {
-		log.Printf("Failed to create Docker container: %v", err)
-		return "", "", err
+// ParseLanguage returns the registered language with the given identifier, ignoring case.
+func ParseLanguage(s string) (Language, error) {
+	language := Language(strings.ToLower(s))
+	if _, err := lookupLanguage(language); err != nil {
+		return "", err
 	}
+	return language, nil
+}
 
-	if err := startContainer(ctx, apiClient, resp.ID); err != nil {
-		log.Printf("Failed to start Docker container: %v", err)
-		return "", "", err
-	}
-	stdout, stderr, err := getContainerLogs(ctx, apiClient, resp.ID)
+// RunProgram runs the given program with the default runner in the specified language.
+// A program that fails to compile is reported with the compilation error verdict and the diagnostics as stderr.
+func RunProgram(ctx context.Context, program string, language Language) (ExecutionResult, error) {
+	compile, results, err := RunProgramWithInputs(ctx, program, language, []Input{StringInput("")})
 	if err != nil {
-		log.Printf("Failed to get Docker container logs: %v", err)
-		return "", "", err
+		return ExecutionResult{Verdict: VerdictInternalError}, err
 	}
-
-	if err := removeContainer(ctx, apiClient, resp.ID); err != nil {
-		log.Printf("Failed to remove Docker container: %v", err)
-		return "", "", err
+	if !compile.Success {
+		return ExecutionResult{Stderr: compile.Diagnostics, Verdict: VerdictCompilationError}, nil
 	}
 
-	return stdout, stderr, err
+	return results[0], nil
 }
 
-// getContainerConfig returns the Docker container image, command, and name based on the programming language.
-func getContainerConfig(program string, language Language) (string, []string, string, error) {
-	containerImage := ""
-	cmd := []string{}
-	containerName := ""
-
-	switch language {
-	case PYTHON:
-		containerImage = "python"
-		cmd = []string{"python", "-c", program}
-		containerName = "python-code-runner"
-	case JAVA:
-		containerImage = "openjdk"
-		cmd = []string{"sh", "-c", "echo '" + program + "' > Main.java && javac Main.java && java Main"}
-		containerName = "java-code-runner"
-	case C:
-		containerImage = "gcc"
-		cmd = []string{"sh", "-c", "echo '" + program + "' > main.c && gcc main.c -o main && ./main"}
-		containerName = "c-code-runner"
-	case CPP:
-		containerImage = "gcc"
-		cmd = []string{"sh", "-c", "echo '" + program + "' > main.cpp && g++ main.cpp -o main && ./main"}
-		containerName = "cpp-code-runner"
-	default:
-		log.Printf("Unsupported language: %s", language)
-		return "", cmd, "", fmt.Errorf("unsupported language: %s", language)
+// RunProgramWithInputs compiles the given program with the default runner and runs it once per input.
+func RunProgramWithInputs(ctx context.Context, program string, language Language, inputs []Input) (CompileResult, []ExecutionResult, error) {
+	runner, err := getDefaultRunner()
+	if err != nil {
+		log.Printf("Failed to create runner: %v", err)
+		return CompileResult{}, nil, err
 	}
 
-	return containerImage, cmd, containerName, nil
+	return RunProgramWith(ctx, runner, program, language, DefaultLimits, inputs)
 }
 
-// createNewAPIClient creates a new Docker API client.
-func createNewAPIClient() (*client.Client, error) {
-	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-}
-
-// createContainer creates a new Docker container with the specified image, command, and name.
-func createContainer(ctx context.Context, apiClient *client.Client, containerImage string, cmd []string, containerName string) (container.CreateResponse, error) {
-	pidsLimit := int64(100)
-
-	return apiClient.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image:           containerImage,
-			Cmd:             cmd,
-			AttachStdout:    true,
-			AttachStderr:    true,
-			NetworkDisabled: true,
-			User:            "nobody", // Run as non-root user
-		},
-		&container.HostConfig{
-			Resources: container.Resources{
-				Memory:    MemoryLimit,
-				CPUQuota:  CPUQuota,
-				PidsLimit: &pidsLimit,
-			},
-			NetworkMode:    "none", // Disable networking
-			ReadonlyRootfs: true,   // Make filesystem read-only
-			SecurityOpt: []string{
-				"no-new-privileges", // Prevent escalation of privileges
-			},
-		},
-		nil,
-		nil,
-		containerName,
-	)
-}
-
-// startContainer starts the Docker container with the specified ID.
-func startContainer(ctx context.Context, apiClient *client.Client, containerID string) error {
-	if err := apiClient.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
-		return err
-	}
-
-	// Wait for the Docker container to finish running
-	statusCh, errCh := apiClient.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return err
-		}
-	case <-statusCh:
+// RunProgramWith compiles the given program once with the given runner and runs the artifact once per input under the limits.
+// The extra files are placed next to the program in the working directory. Cancelling the context kills the program and releases the sandbox.
+func RunProgramWith(ctx context.Context, runner Runner, program string, language Language, limits Limits, inputs []Input, files ...File) (CompileResult, []ExecutionResult, error) {
+	tests := make([]TestCase, 0, len(inputs))
+	for _, input := range inputs {
+		tests = append(tests, TestCase{Input: input})
 	}
 
-	return nil
+	result, err := RunJobWith(ctx, runner, Job{
+		Program:  program,
+		Language: language,
+		Limits:   limits,
+		Tests:    tests,
+		Files:    files,
+	})
+	return result.Compile, result.Results, err
 }
 
-// getContainerLogs returns the logs from the Docker container with the specified ID.
-func getContainerLogs(ctx context.Context, apiClient *client.Client, containerID string) (string, string, error) {
-	out, err := apiClient.ContainerLogs(
-		ctx,
-		containerID,
-		container.LogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-			Timestamps: true,
-			Follow:     true,
-			Details:    true,
-		})
-	if err != nil {
-		return "", "", err
-	}
-	defer out.Close()
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	_, err = stdcopy.StdCopy(stdout, stderr, out)
-	if err != nil {
-		return "", "", err
+// sandboxFiles returns the source file of the program followed by the extra files.
+func sandboxFiles(spec LanguageSpec, program string, files []File) ([]File, error) {
+	all := append([]File{{Name: spec.SourceFile, Content: []byte(program)}}, files...)
+	if err := validateFiles(all); err != nil {
+		return nil, err
 	}
-
-	// Combine stdout and stderr logs
-	return stdout.String(), stderr.String(), nil
-}
-
-// removeContainer removes the Docker container with the specified ID.
-func removeContainer(ctx context.Context, apiClient *client.Client, containerID string) error {
-	return apiClient.ContainerRemove(ctx, containerID, container.RemoveOptions{})
+	return all, nil
 }
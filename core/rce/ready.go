@@ -0,0 +1,28 @@
+package rce
+
+import "sync"
+
+// Readiness says whether the engine can judge programs yet.
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Images []ImageStatus `json:"images"` // Runner images of the Docker runner, empty for other runners
+}
+
+var (
+	readiness   Readiness
+	readinessMu sync.RWMutex
+)
+
+// SetReadiness records whether the engine can judge programs. The engine starts out not ready.
+func SetReadiness(r Readiness) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+	readiness = r
+}
+
+// CurrentReadiness returns whether the engine can judge programs.
+func CurrentReadiness() Readiness {
+	readinessMu.RLock()
+	defer readinessMu.RUnlock()
+	return readiness
+}
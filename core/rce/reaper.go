@@ -0,0 +1,120 @@
+package rce
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Labels of every container created by the engine.
+const (
+	sandboxLabel  = "kiit-lab-engine.sandbox"
+	instanceLabel = "kiit-lab-engine.instance" // Runner that created the container
+	deadlineLabel = "kiit-lab-engine.deadline" // Unix time after which the container is reaped unless its runner still uses it
+)
+
+const reaperInterval = time.Minute
+
+// SandboxDeadline is how long a container may host a sandbox beyond the wall time budget of its job before the reaper removes it.
+var SandboxDeadline = 15 * time.Minute
+
+// warmContainerLifetime is the deadline of warm containers. They are replaced while idle before it comes too close,
+// so they never host a sandbox past it.
+const warmContainerLifetime = time.Hour
+
+// ReaperStats counts the containers removed by the reaper.
+type ReaperStats struct {
+	Sweeps    int64     `json:"sweeps"`
+	Reaped    int64     `json:"reaped"`
+	LastSweep time.Time `json:"lastSweep"`
+}
+
+// StartReaper removes containers of the engine left behind by crashes or failed cleanups, once now and then periodically until the context is done.
+// A container is reaped once it is past its deadline, unless this runner keeps it warm or hosts a sandbox in it that is within its lifetime.
+func (d *DockerRunner) StartReaper(ctx context.Context) {
+	go func() {
+		d.reap(ctx)
+
+		ticker := time.NewTicker(reaperInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.reap(ctx)
+			}
+		}
+	}()
+}
+
+// ReaperStats returns how many containers the reaper removed so far.
+func (d *DockerRunner) ReaperStats() ReaperStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reaperStats
+}
+
+// reap removes every expired container of the engine.
+func (d *DockerRunner) reap(ctx context.Context) {
+	containers, err := d.apiClient.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", sandboxLabel)),
+	})
+	if err != nil {
+		log.Printf("Failed to list Docker containers: %v", err)
+		return
+	}
+
+	now := time.Now()
+	reaped := int64(0)
+	for _, c := range containers {
+		if !d.expired(c.ID, c.Labels, now) {
+			continue
+		}
+
+		if err := removeContainer(ctx, d.apiClient, c.ID); err != nil && !client.IsErrNotFound(err) {
+			log.Printf("Failed to remove Docker container: %v", err)
+			continue
+		}
+		log.Printf("Reaped Docker container %s", c.ID)
+		reaped++
+	}
+
+	d.mu.Lock()
+	d.reaperStats.Sweeps++
+	d.reaperStats.Reaped += reaped
+	d.reaperStats.LastSweep = now
+	d.mu.Unlock()
+}
+
+// expired reports whether the container with the labels should be reaped.
+func (d *DockerRunner) expired(containerID string, labels map[string]string, now time.Time) bool {
+	if labels[instanceLabel] == d.instance {
+		// Containers move between the warm pool and the sandboxes under the lock, so they are always in one of them
+		d.mu.Lock()
+		idle := d.warm != nil && d.warm.contains(containerID)
+		deadline, active := d.active[containerID]
+		d.mu.Unlock()
+
+		if idle {
+			return false
+		}
+		if active {
+			return now.After(deadline)
+		}
+	}
+
+	// Containers without a valid deadline were not left by a runner that is still working
+	deadline, err := strconv.ParseInt(labels[deadlineLabel], 10, 64)
+	if err != nil {
+		return true
+	}
+	return now.After(time.Unix(deadline, 0))
+}
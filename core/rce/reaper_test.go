@@ -0,0 +1,77 @@
+package rce
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReaperExpired(t *testing.T) {
+	now := time.Now()
+	past, future := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10), strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+
+	runner := &DockerRunner{
+		instance: "runner",
+		warm:     newWarmPool(nil, map[Language]int{C: 1}, nil),
+		active: map[string]time.Time{
+			"active":  now.Add(time.Minute),
+			"overdue": now.Add(-time.Minute),
+		},
+	}
+	runner.warm.add(C, "idle", now.Add(time.Hour))
+
+	tests := []struct {
+		name        string
+		containerID string
+		labels      map[string]string
+		expired     bool
+	}{
+		{
+			name:        "idle in the warm pool past its label deadline",
+			containerID: "idle",
+			labels:      map[string]string{instanceLabel: "runner", deadlineLabel: past},
+		},
+		{
+			name:        "hosting a sandbox within its lifetime",
+			containerID: "active",
+			labels:      map[string]string{instanceLabel: "runner", deadlineLabel: past},
+		},
+		{
+			name:        "hosting a sandbox past its lifetime",
+			containerID: "overdue",
+			labels:      map[string]string{instanceLabel: "runner", deadlineLabel: future},
+			expired:     true,
+		},
+		{
+			name:        "of another runner before its deadline",
+			containerID: "other",
+			labels:      map[string]string{instanceLabel: "other", deadlineLabel: future},
+		},
+		{
+			name:        "of another runner past its deadline",
+			containerID: "other",
+			labels:      map[string]string{instanceLabel: "other", deadlineLabel: past},
+			expired:     true,
+		},
+		{
+			name:        "left by this runner past its deadline",
+			containerID: "removed",
+			labels:      map[string]string{instanceLabel: "runner", deadlineLabel: past},
+			expired:     true,
+		},
+		{
+			name:        "without a deadline",
+			containerID: "other",
+			labels:      map[string]string{instanceLabel: "other"},
+			expired:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runner.expired(test.containerID, test.labels, now); got != test.expired {
+				t.Fatalf("expired() = %v, want %v", got, test.expired)
+			}
+		})
+	}
+}
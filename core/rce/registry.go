@@ -0,0 +1,269 @@
+package rce
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed languages.yaml
+var builtinLanguages []byte
+
+// LanguageSpec describes how programs of a language are built and run.
+type LanguageSpec struct {
+	ID          Language   `yaml:"-"`
+	Name        string     `yaml:"name"`
+	Image       string     `yaml:"image"`      // Docker image with the toolchain
+	SourceFile  string     `yaml:"sourceFile"` // Name the program is saved as in the working directory
+	Extension   string     `yaml:"extension"`
+	CompileCmd  []string   `yaml:"compile"`  // Command that builds the artifact, nil when there is nothing to build
+	SanitizeCmd []string   `yaml:"sanitize"` // Command that builds the artifact with sanitizers for debug runs, nil when unsupported
+	RunCmd      []string   `yaml:"run"`      // Command that runs the artifact
+	VersionCmd  []string   `yaml:"version"`  // Command that prints the toolchain version
+	Env         []string   `yaml:"env"`
+	Limits      LimitsSpec `yaml:"limits"`
+	WarmPool    int        `yaml:"warmPool"` // Idle containers kept started for new sandboxes by the Docker runner
+	Harness     string     `yaml:"harness"`  // Generator of the driver calling a single function of a submission, empty when unsupported
+
+	Memcheck *MemcheckSpec `yaml:"memcheck"` // Runs under Valgrind memcheck, nil when unsupported
+	Flags    *FlagsSpec    `yaml:"flags"`    // Compiler flags questions may set, nil when they may set none
+
+	Diagnostics string `yaml:"diagnostics"` // Format of the compiler output parsed into diagnostics, empty leaves it unparsed
+}
+
+// MemcheckSpec describes how programs of a language are built and run under Valgrind memcheck.
+type MemcheckSpec struct {
+	Image      string   `yaml:"image"`   // Docker image with the toolchain and valgrind, the image of the language when empty
+	CompileCmd []string `yaml:"compile"` // Command that builds the artifact with the debug info Valgrind reports lines from
+}
+
+// LimitsSpec are the default limits of a language, zero fields fall back to DefaultLimits.
+// The multipliers scale the limits questions set, for languages that need more time or memory for the same work.
+type LimitsSpec struct {
+	WallTime         time.Duration `yaml:"wallTime"`
+	CPUTime          time.Duration `yaml:"cpuTime"`
+	OutputLimit      int64         `yaml:"outputLimit"`
+	Memory           int64         `yaml:"memory"`           // Bytes of memory of the sandbox, 0 is MemoryLimit
+	TimeMultiplier   float64       `yaml:"timeMultiplier"`   // 0 is 1
+	MemoryMultiplier float64       `yaml:"memoryMultiplier"` // 0 is 1
+}
+
+// Registry is the set of languages the engine can run.
+type Registry struct {
+	languages map[Language]LanguageSpec
+}
+
+var (
+	defaultRegistry   = mustParseRegistry(builtinLanguages)
+	defaultRegistryMu sync.RWMutex
+)
+
+// LoadRegistry reads the language registry from the YAML file at the given path.
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read language registry: %w", err)
+	}
+	return ParseRegistry(data)
+}
+
+// ParseRegistry parses a YAML language registry keyed by language identifier.
+func ParseRegistry(data []byte) (*Registry, error) {
+	specs := map[string]LanguageSpec{}
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse language registry: %w", err)
+	}
+
+	registry := &Registry{languages: map[Language]LanguageSpec{}}
+	for id, spec := range specs {
+		spec.ID = Language(strings.ToLower(id))
+		if err := spec.validate(); err != nil {
+			return nil, err
+		}
+		registry.languages[spec.ID] = spec
+	}
+
+	return registry, nil
+}
+
+// mustParseRegistry parses the built-in registry, which is known to be valid.
+func mustParseRegistry(data []byte) *Registry {
+	registry, err := ParseRegistry(data)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// SetDefaultRegistry sets the registry languages are looked up in.
+func SetDefaultRegistry(registry *Registry) {
+	defaultRegistryMu.Lock()
+	defer defaultRegistryMu.Unlock()
+	defaultRegistry = registry
+}
+
+// DefaultRegistry returns the registry languages are looked up in.
+func DefaultRegistry() *Registry {
+	defaultRegistryMu.RLock()
+	defer defaultRegistryMu.RUnlock()
+	return defaultRegistry
+}
+
+// Get returns the spec of the language.
+func (r *Registry) Get(language Language) (LanguageSpec, error) {
+	spec, ok := r.languages[language]
+	if !ok {
+		log.Printf("Unsupported language: %s", language)
+		return LanguageSpec{}, fmt.Errorf("unsupported language: %s", language)
+	}
+	return spec, nil
+}
+
+// Languages returns the identifiers of every registered language in sorted order.
+func (r *Registry) Languages() []Language {
+	languages := make([]Language, 0, len(r.languages))
+	for language := range r.languages {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i] < languages[j] })
+	return languages
+}
+
+// WarmPoolSizes returns the number of warm containers of every language that keeps some.
+func (r *Registry) WarmPoolSizes() map[Language]int {
+	sizes := map[Language]int{}
+	for language, spec := range r.languages {
+		if spec.WarmPool > 0 {
+			sizes[language] = spec.WarmPool
+		}
+	}
+	return sizes
+}
+
+// validate checks that the spec has everything needed to run a program.
+func (s LanguageSpec) validate() error {
+	switch {
+	case s.ID == "":
+		return fmt.Errorf("language registry: empty language identifier")
+	case s.Image == "":
+		return fmt.Errorf("language registry: %s has no image", s.ID)
+	case len(s.RunCmd) == 0:
+		return fmt.Errorf("language registry: %s has no run command", s.ID)
+	}
+	if err := validateFiles([]File{{Name: s.SourceFile}}); err != nil {
+		return fmt.Errorf("language registry: %s: %w", s.ID, err)
+	}
+	if _, ok := harnessGenerators[s.Harness]; s.Harness != "" && !ok {
+		return fmt.Errorf("language registry: %s has unknown harness %s", s.ID, s.Harness)
+	}
+	if _, ok := diagnosticsParsers[s.Diagnostics]; s.Diagnostics != "" && !ok {
+		return fmt.Errorf("language registry: %s has unknown diagnostics format %s", s.ID, s.Diagnostics)
+	}
+	if s.Limits.TimeMultiplier < 0 || s.Limits.MemoryMultiplier < 0 {
+		return fmt.Errorf("language registry: %s has a negative limit multiplier", s.ID)
+	}
+	if s.Limits.Memory < 0 {
+		return fmt.Errorf("language registry: %s has a negative memory limit", s.ID)
+	}
+	if s.Memcheck != nil && len(s.Memcheck.CompileCmd) == 0 {
+		return fmt.Errorf("language registry: %s has no memcheck compile command", s.ID)
+	}
+	if s.Flags != nil && s.CompileCmd == nil {
+		return fmt.Errorf("language registry: %s has compiler flags but no compile command", s.ID)
+	}
+	if s.Flags != nil && len(s.Flags.Standards) > 0 && len(s.Flags.StandardArgs) == 0 {
+		return fmt.Errorf("language registry: %s has standards but no standard arguments", s.ID)
+	}
+	return nil
+}
+
+// DefaultLimits returns the default limits of the language, filling unset fields from DefaultLimits.
+func (s LanguageSpec) DefaultLimits() Limits {
+	limits := DefaultLimits
+	if s.Limits.WallTime > 0 {
+		limits.WallTime = s.Limits.WallTime
+	}
+	if s.Limits.CPUTime > 0 {
+		limits.CPUTime = s.Limits.CPUTime
+	}
+	if s.Limits.OutputLimit > 0 {
+		limits.OutputLimit = s.Limits.OutputLimit
+	}
+	return limits
+}
+
+// DefaultResources returns the resources of sandboxes of the language, DefaultResources with the memory of the language if it sets one.
+func (s LanguageSpec) DefaultResources() Resources {
+	resources := DefaultResources
+	if s.Limits.Memory > 0 {
+		resources.Memory = s.Limits.Memory
+	}
+	return resources
+}
+
+// lookupLanguage returns the spec of the language from the default registry.
+func lookupLanguage(language Language) (LanguageSpec, error) {
+	return DefaultRegistry().Get(language)
+}
+
+// lookupCompileSpec returns the spec of the language adjusted for the compile options.
+func lookupCompileSpec(language Language, opts CompileOptions) (LanguageSpec, error) {
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		return LanguageSpec{}, err
+	}
+
+	if opts.Sanitize && opts.Memcheck {
+		return LanguageSpec{}, fmt.Errorf("sanitizer and memcheck runs cannot be combined")
+	}
+
+	if opts.Sanitize {
+		if spec.SanitizeCmd == nil {
+			return LanguageSpec{}, fmt.Errorf("sanitizer runs are not supported for %s", language)
+		}
+		spec.CompileCmd = spec.SanitizeCmd
+		spec.Env = append(append([]string(nil), spec.Env...), sanitizerEnv...)
+	}
+
+	if opts.Memcheck {
+		if spec.Memcheck == nil {
+			return LanguageSpec{}, fmt.Errorf("memcheck runs are not supported for %s", language)
+		}
+		spec.CompileCmd = spec.Memcheck.CompileCmd
+		if spec.Memcheck.Image != "" {
+			spec.Image = spec.Memcheck.Image
+		}
+	}
+
+	if opts.Flags != nil {
+		if err := opts.Flags.validate(spec); err != nil {
+			return LanguageSpec{}, err
+		}
+		if spec.CompileCmd != nil {
+			spec.CompileCmd = opts.Flags.apply(spec, spec.CompileCmd)
+		}
+	}
+	return spec, nil
+}
+
+// SupportsMemcheck reports whether programs of the language can run under Valgrind memcheck.
+func SupportsMemcheck(language Language) bool {
+	spec, err := lookupLanguage(language)
+	return err == nil && spec.Memcheck != nil
+}
+
+// LimitsFor returns the default limits of the language, or DefaultLimits when it is not registered.
+func LimitsFor(language Language) Limits {
+	spec, err := lookupLanguage(language)
+	if err != nil {
+		return DefaultLimits
+	}
+	return spec.DefaultLimits()
+}
@@ -0,0 +1,73 @@
+package rce
+
+import "time"
+
+// Verdict is the outcome of running a program.
+type Verdict string
+
+const (
+	VerdictOK                  Verdict = "OK"
+	VerdictCompilationError    Verdict = "CE"
+	VerdictRuntimeError        Verdict = "RE"
+	VerdictTimeLimitExceeded   Verdict = "TLE"
+	VerdictMemoryLimitExceeded Verdict = "MLE"
+	VerdictOutputLimitExceeded Verdict = "OLE"
+	VerdictInternalError       Verdict = "IE"
+
+	// Verdicts of a checker on the output of a program that ran OK
+	VerdictAccepted          Verdict = "AC"
+	VerdictWrongAnswer       Verdict = "WA"
+	VerdictPresentationError Verdict = "PE"
+
+	// Verdict of a run that ended OK or accepted but leaked memory, in jobs requiring leak-free programs
+	VerdictMemoryLeak Verdict = "ML"
+)
+
+// ExecutionResult is the outcome of a single run of a program.
+type ExecutionResult struct {
+	Stdout          string        `json:"stdout"`
+	Stderr          string        `json:"stderr"`
+	ExitCode        int           `json:"exitCode"`
+	Signal          int           `json:"signal"`    // Signal that terminated the program, 0 if it exited on its own
+	OOMKilled       bool          `json:"oomKilled"` // Killed by the kernel for exceeding the memory limit
+	WallTime        time.Duration `json:"wallTime"`
+	CPUTime         time.Duration `json:"cpuTime"`
+	PeakMemory      int64         `json:"peakMemory"` // Bytes, 0 when the runner cannot measure it
+	OutputTruncated bool          `json:"outputTruncated"`
+	Verdict         Verdict       `json:"verdict"`
+	CheckerMessage  string        `json:"checkerMessage,omitempty"` // Why the checker or the interactor did not accept the output
+
+	Transcript          []TranscriptEntry `json:"transcript,omitempty"`          // Conversation with the interactor of an interactive question
+	TranscriptTruncated bool              `json:"transcriptTruncated,omitempty"` // The conversation was longer than the transcript keeps
+
+	Findings []SanitizerFinding `json:"findings,omitempty"` // Errors the sanitizers reported during a debug run
+	Memcheck *MemcheckReport    `json:"memcheck,omitempty"` // What Valgrind found during a memcheck run
+
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"` // Errors parsed from stderr, like the traceback of an uncaught Python exception
+}
+
+const exitCodeSignalBase = 128 // Shells report a child killed by signal N as exit status 128+N
+
+// signalFromExitCode returns the signal encoded in a shell style exit status, or 0.
+func signalFromExitCode(exitCode int) int {
+	if exitCode > exitCodeSignalBase && exitCode < exitCodeSignalBase+65 {
+		return exitCode - exitCodeSignalBase
+	}
+	return 0
+}
+
+// newVerdict derives the verdict from how the program terminated.
+func newVerdict(result ExecutionResult, timedOut bool) Verdict {
+	switch {
+	case timedOut:
+		return VerdictTimeLimitExceeded
+	case result.OOMKilled:
+		return VerdictMemoryLimitExceeded
+	case result.OutputTruncated:
+		return VerdictOutputLimitExceeded
+	case result.ExitCode != 0 || result.Signal != 0:
+		return VerdictRuntimeError
+	default:
+		return VerdictOK
+	}
+}
@@ -0,0 +1,174 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Runner executes programs inside a sandbox.
+type Runner interface {
+	// Compile places the program and the extra files in a new sandbox and builds the artifact that runs reuse, as the options ask.
+	// The sandbox is returned even when compilation fails and must be cleaned up.
+	// Cancelling the context stops the compiler and releases the sandbox.
+	Compile(ctx context.Context, program string, language Language, files []File, opts CompileOptions) (*Sandbox, CompileResult, error)
+	// Run executes the compiled artifact in the sandbox with stdin attached under the given limits.
+	// Cancelling the context kills the program and returns the context error.
+	Run(ctx context.Context, sandbox *Sandbox, stdin io.Reader, limits Limits) (ExecutionResult, error)
+	// AddFiles places the files in the working directory of the sandbox, replacing files with the same name.
+	// Files added after compilation are lost on the next Reset.
+	AddFiles(ctx context.Context, sandbox *Sandbox, files []File) error
+	// Reset restores the working directory to its state right after compilation and stops whatever the previous run left behind,
+	// so runs in the same sandbox cannot see each other.
+	Reset(ctx context.Context, sandbox *Sandbox) error
+	// Cleanup releases every resource held by the sandbox.
+	// It takes no context so the sandbox is released even after the job was cancelled.
+	Cleanup(sandbox *Sandbox) error
+}
+
+// Sandbox is a program prepared for execution by a Runner.
+type Sandbox struct {
+	ID       string // Backend specific identifier (container ID, working directory, ...)
+	Language Language
+	Program  string
+	Files    []File   // Source file and extra files copied into the working directory
+	Args     []string // Arguments appended to the run command of the language
+
+	stdout   io.Writer // Receives the stdout of runs as it is written, if set
+	options  CompileOptions
+	spec     LanguageSpec
+	snapshot []byte // Tar archive of the working directory right after compilation
+	oomKills int64  // OOM kills counted in the container of the sandbox so far, Docker only
+}
+
+// runCmd returns the command that runs the compiled artifact with the arguments of the sandbox.
+func (s *Sandbox) runCmd() []string {
+	cmd := append(append([]string(nil), s.spec.RunCmd...), s.Args...)
+	if s.options.Memcheck {
+		cmd = append(append([]string(nil), memcheckCmd...), cmd...)
+	}
+	return cmd
+}
+
+// CompileOptions change how a program is built.
+type CompileOptions struct {
+	Sanitize bool // Build with AddressSanitizer and UndefinedBehaviorSanitizer and report their findings with every run
+	Memcheck bool // Build with debug info and run under Valgrind memcheck, reporting leaks and invalid accesses with every run
+
+	Flags     *CompilerFlags // Compiler flags of the question, nil builds with the compile command as is
+	Resources Resources      // Resources of the sandbox, zero fields use the defaults of the language
+	Budget    time.Duration  // Wall time the job of the sandbox may take in all, the sandbox may live SandboxDeadline longer
+}
+
+// lifetime returns how long the sandbox may live before the reaper removes its container.
+func (o CompileOptions) lifetime() time.Duration {
+	return o.Budget + SandboxDeadline
+}
+
+// debug reports whether the options build a debug artifact, whose runtime needs more memory than a normal run.
+func (o CompileOptions) debug() bool {
+	return o.Sanitize || o.Memcheck
+}
+
+// resources returns the resources of a sandbox of the language built with the options, with enough memory for the runtime of debug artifacts.
+func (o CompileOptions) resources(spec LanguageSpec) Resources {
+	resources := o.Resources.withDefaults(spec.DefaultResources())
+	if o.debug() && resources.Memory < DebugMemoryLimit {
+		resources.Memory = DebugMemoryLimit
+	}
+	return resources
+}
+
+// pooled reports whether sandboxes of the language built with the options can come from and return to the warm pool,
+// whose containers have the default resources of their language.
+func (o CompileOptions) pooled(spec LanguageSpec) bool {
+	return !o.debug() && o.resources(spec) == spec.DefaultResources()
+}
+
+// CompileResult is the outcome of building a program.
+type CompileResult struct {
+	Success     bool          `json:"success"`
+	Diagnostics string        `json:"diagnostics"`        // Compiler output
+	Messages    []Diagnostic  `json:"messages,omitempty"` // Diagnostics parsed from the compiler output by jobs, with lines in the submitted code
+	Time        time.Duration `json:"time"`
+	Cached      bool          `json:"cached"` // The artifact came from the artifact cache instead of the compiler
+}
+
+// newCompileResult builds the compile result from the run of the compiler.
+func newCompileResult(result ExecutionResult) CompileResult {
+	diagnostics := result.Stderr + result.Stdout
+	switch result.Verdict {
+	case VerdictTimeLimitExceeded:
+		diagnostics += "compilation timed out\n"
+	case VerdictMemoryLimitExceeded:
+		diagnostics += "compilation ran out of memory\n"
+	}
+
+	return CompileResult{
+		Success:     result.Verdict == VerdictOK,
+		Diagnostics: diagnostics,
+		Time:        result.WallTime,
+	}
+}
+
+const (
+	DockerRunnerKind  = "docker"
+	ProcessRunnerKind = "process"
+)
+
+const sandboxUserID = 65534 // uid/gid of nobody, the user programs run as
+
+var (
+	defaultRunner   Runner
+	defaultRunnerMu sync.RWMutex
+)
+
+// NewRunner creates the runner backend with the given kind, defaulting to Docker.
+func NewRunner(kind string) (Runner, error) {
+	switch kind {
+	case "", DockerRunnerKind:
+		runner, err := NewDockerRunner()
+		if err != nil {
+			return nil, err
+		}
+		return runner, nil
+	case ProcessRunnerKind:
+		runner, err := NewProcessRunner()
+		if err != nil {
+			return nil, err
+		}
+		return runner, nil
+	default:
+		return nil, fmt.Errorf("unsupported runner: %s", kind)
+	}
+}
+
+// SetDefaultRunner sets the runner used by RunProgram.
+func SetDefaultRunner(runner Runner) {
+	defaultRunnerMu.Lock()
+	defer defaultRunnerMu.Unlock()
+	defaultRunner = runner
+}
+
+// getDefaultRunner returns the runner used by RunProgram, creating a Docker runner if none is set.
+func getDefaultRunner() (Runner, error) {
+	defaultRunnerMu.RLock()
+	runner := defaultRunner
+	defaultRunnerMu.RUnlock()
+	if runner != nil {
+		return runner, nil
+	}
+
+	defaultRunnerMu.Lock()
+	defer defaultRunnerMu.Unlock()
+	if defaultRunner == nil {
+		r, err := NewDockerRunner()
+		if err != nil {
+			return nil, err
+		}
+		defaultRunner = r
+	}
+	return defaultRunner, nil
+}
@@ -0,0 +1,160 @@
+package rce
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sanitizerEnv configures the sanitizers of programs built for debug runs.
+var sanitizerEnv = []string{
+	// LeakSanitizer cannot stop the world inside the sandbox
+	"ASAN_OPTIONS=detect_leaks=0",
+	"UBSAN_OPTIONS=print_stacktrace=1",
+}
+
+// maxSanitizerFindings caps the findings reported for a single run.
+const maxSanitizerFindings = 20
+
+// SanitizerFinding is an error a sanitizer reported during a debug run.
+type SanitizerFinding struct {
+	Sanitizer string       `json:"sanitizer"` // address or undefined
+	Kind      string       `json:"kind"`      // heap-buffer-overflow, SEGV, undefined-behavior, ...
+	Message   string       `json:"message"`
+	File      string       `json:"file,omitempty"` // Submission file the error happened in, if known
+	Line      int          `json:"line,omitempty"`
+	Stack     []StackFrame `json:"stack,omitempty"`
+}
+
+// StackFrame is a frame of the stack trace of a sanitizer finding or a memcheck record.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+var (
+	// ==12==ERROR: AddressSanitizer: heap-buffer-overflow on address 0x602000000014 at pc ...
+	asanErrorPattern = regexp.MustCompile(`^==\d+==ERROR: AddressSanitizer: (\S+)(.*)$`)
+	// main.c:4:7: runtime error: signed integer overflow: 2147483647 + 1 cannot be represented in type 'int'
+	ubsanErrorPattern = regexp.MustCompile(`^(.+?):(\d+):\d+: runtime error: (.*)$`)
+	//     #0 0x401234 in main /workspace/main.c:5
+	framePattern = regexp.MustCompile(`^\s*#\d+ 0x[0-9a-fA-F]+ (.*)$`)
+	// /workspace/main.c:5 or /workspace/main.c:5:10
+	locationPattern = regexp.MustCompile(`^(.+?):(\d+)(?::\d+)?$`)
+	// ==12== in front of AddressSanitizer lines
+	pidPrefixPattern = regexp.MustCompile(`^==\d+==`)
+)
+
+// withFindings adds the findings of the sanitizers to the result of a run of a sanitized program.
+func (s *Sandbox) withFindings(result ExecutionResult) ExecutionResult {
+	if s.options.Sanitize {
+		result.Findings = parseSanitizerReport(result.Stderr, s.Files)
+	}
+	return result
+}
+
+// parseSanitizerReport extracts the errors reported by AddressSanitizer and UndefinedBehaviorSanitizer from the stderr of a run.
+// Paths of the submission files are reported relative to the working directory.
+func parseSanitizerReport(stderr string, files []File) []SanitizerFinding {
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+
+	var findings []SanitizerFinding
+	var current *SanitizerFinding
+	stackDone := false // Only the first stack of a report is where the error happened
+
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if match := asanErrorPattern.FindStringSubmatch(line); match != nil {
+			findings = append(findings, SanitizerFinding{
+				Sanitizer: "address",
+				Kind:      match[1],
+				Message:   match[1] + match[2],
+			})
+			current, stackDone = &findings[len(findings)-1], false
+			continue
+		}
+
+		if match := ubsanErrorPattern.FindStringSubmatch(line); match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			finding := SanitizerFinding{
+				Sanitizer: "undefined",
+				Kind:      "undefined-behavior",
+				Message:   match[3],
+			}
+			if file := submissionFile(match[1], names); file != "" {
+				finding.File, finding.Line = file, lineNumber
+			}
+			findings = append(findings, finding)
+			current, stackDone = &findings[len(findings)-1], false
+			continue
+		}
+
+		if current == nil || stackDone {
+			continue
+		}
+
+		if match := framePattern.FindStringSubmatch(line); match != nil {
+			frame, ok := parseFrame(match[1], names)
+			if !ok {
+				continue
+			}
+			current.Stack = append(current.Stack, frame)
+			if current.File == "" && names[frame.File] {
+				current.File, current.Line = frame.File, frame.Line
+			}
+			continue
+		}
+
+		switch {
+		case len(current.Stack) > 0:
+			stackDone = true
+		case strings.TrimSpace(line) != "" && current.Sanitizer == "address":
+			// Details printed before the stack, like the size of the bad access
+			current.Message += "\n" + strings.TrimSpace(pidPrefixPattern.ReplaceAllString(line, ""))
+		}
+	}
+
+	if len(findings) > maxSanitizerFindings {
+		findings = findings[:maxSanitizerFindings]
+	}
+	return findings
+}
+
+// parseFrame parses the part of a stack frame after its address: "in <function> <location>".
+// Frames without a function name are skipped.
+func parseFrame(frame string, names map[string]bool) (StackFrame, bool) {
+	frame, ok := strings.CutPrefix(frame, "in ")
+	if !ok {
+		return StackFrame{}, false
+	}
+
+	// Demangled C++ names contain spaces, the location never does
+	split := strings.LastIndex(frame, " ")
+	if split < 0 {
+		return StackFrame{Function: frame}, true
+	}
+
+	result := StackFrame{Function: frame[:split]}
+	if match := locationPattern.FindStringSubmatch(frame[split+1:]); match != nil {
+		result.Line, _ = strconv.Atoi(match[2])
+		result.File = match[1]
+		if file := submissionFile(match[1], names); file != "" {
+			result.File = file
+		}
+	}
+	return result, true
+}
+
+// submissionFile returns the name of the submission file at the path, or an empty string when the path is outside the submission.
+func submissionFile(path string, names map[string]bool) string {
+	if name := filepath.Base(path); names[name] {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package rce
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSanitizerReport(t *testing.T) {
+	files := []File{{Name: "main.c"}}
+
+	tests := []struct {
+		name   string
+		stderr string
+		want   []SanitizerFinding
+	}{
+		{
+			name: "address",
+			stderr: "=================================================================\n" +
+				"==12==ERROR: AddressSanitizer: heap-buffer-overflow on address 0x602000000014 at pc 0x401234 bp 0x7ffd sp 0x7ffc\n" +
+				"WRITE of size 4 at 0x602000000014 thread T0\n" +
+				"    #0 0x401234 in fill /workspace/main.c:5\n" +
+				"    #1 0x401300 in main /workspace/main.c:10:3\n" +
+				"    #2 0x7f0000 in __libc_start_main (/lib/x86_64-linux-gnu/libc.so.6+0x21b96)\n" +
+				"\n" +
+				"0x602000000014 is located 0 bytes to the right of 4-byte region\n" +
+				"allocated by thread T0 here:\n" +
+				"    #0 0x7f1000 in malloc (/usr/lib/libasan.so+0x10)\n" +
+				"    #1 0x401290 in main /workspace/main.c:9\n",
+			want: []SanitizerFinding{{
+				Sanitizer: "address",
+				Kind:      "heap-buffer-overflow",
+				Message:   "heap-buffer-overflow on address 0x602000000014 at pc 0x401234 bp 0x7ffd sp 0x7ffc\nWRITE of size 4 at 0x602000000014 thread T0",
+				File:      "main.c",
+				Line:      5,
+				Stack: []StackFrame{
+					{Function: "fill", File: "main.c", Line: 5},
+					{Function: "main", File: "main.c", Line: 10},
+					{Function: "__libc_start_main"},
+				},
+			}},
+		},
+		{
+			name: "undefined behavior",
+			stderr: "main.c:4:7: runtime error: signed integer overflow: 2147483647 + 1 cannot be represented in type 'int'\n" +
+				"    #0 0x401234 in main /workspace/main.c:4\n" +
+				"/usr/include/stdlib.h:3:1: runtime error: load of misaligned address\n",
+			want: []SanitizerFinding{
+				{
+					Sanitizer: "undefined",
+					Kind:      "undefined-behavior",
+					Message:   "signed integer overflow: 2147483647 + 1 cannot be represented in type 'int'",
+					File:      "main.c",
+					Line:      4,
+					Stack:     []StackFrame{{Function: "main", File: "main.c", Line: 4}},
+				},
+				{
+					Sanitizer: "undefined",
+					Kind:      "undefined-behavior",
+					Message:   "load of misaligned address",
+				},
+			},
+		},
+		{
+			name: "demangled c++ frame",
+			stderr: "==7==ERROR: AddressSanitizer: SEGV on unknown address 0x000000000000\n" +
+				"    #0 0x401234 in solve(std::vector<int, std::allocator<int> >&) /workspace/main.cpp:3\n",
+			want: []SanitizerFinding{{
+				Sanitizer: "address",
+				Kind:      "SEGV",
+				Message:   "SEGV on unknown address 0x000000000000",
+				Stack:     []StackFrame{{Function: "solve(std::vector<int, std::allocator<int> >&)", File: "/workspace/main.cpp", Line: 3}},
+			}},
+		},
+		{
+			name:   "no findings",
+			stderr: "some output of the program\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseSanitizerReport(test.stderr, files)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("parseSanitizerReport() =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
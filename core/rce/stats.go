@@ -0,0 +1,30 @@
+package rce
+
+// Stats is a snapshot of the load on the engine and of the work done by its background tasks.
+type Stats struct {
+	Pool     PoolStats                  `json:"pool"`
+	WarmPool map[Language]WarmPoolStats `json:"warmPool,omitempty"` // Docker runner only
+	Reaper   *ReaperStats               `json:"reaper,omitempty"`   // Docker runner only
+	Cache    *ArtifactCacheStats        `json:"cache,omitempty"`    // Only when the artifact cache is enabled
+}
+
+// CurrentStats returns the stats of the default pool, the default runner and the default artifact cache.
+func CurrentStats() Stats {
+	stats := Stats{Pool: DefaultPool().Stats()}
+
+	if cache := DefaultArtifactCache(); cache != nil {
+		cacheStats := cache.Stats()
+		stats.Cache = &cacheStats
+	}
+
+	defaultRunnerMu.RLock()
+	runner := defaultRunner
+	defaultRunnerMu.RUnlock()
+
+	if dockerRunner, ok := runner.(*DockerRunner); ok {
+		reaper := dockerRunner.ReaperStats()
+		stats.WarmPool = dockerRunner.WarmPoolStats()
+		stats.Reaper = &reaper
+	}
+	return stats
+}
@@ -0,0 +1,306 @@
+package rce
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	warmPoolCheckInterval = 30 * time.Second
+	maxWarmContainerUses  = 100 // Containers are replaced after hosting this many sandboxes
+)
+
+// WarmPoolStats is a snapshot of the warm containers of a language.
+type WarmPoolStats struct {
+	Size      int   `json:"size"`      // Idle containers the pool keeps ready
+	Idle      int   `json:"idle"`      // Idle containers ready right now
+	Hits      int64 `json:"hits"`      // Sandboxes placed in a warm container
+	Misses    int64 `json:"misses"`    // Sandboxes that had to wait for a new container
+	Recycled  int64 `json:"recycled"`  // Containers reset and returned to the pool after use
+	Unhealthy int64 `json:"unhealthy"` // Idle containers found stopped and replaced
+}
+
+// warmPool keeps started idle containers per language so a sandbox does not wait for one to be created and started.
+// Containers are reset after use and go back to the pool until they have hosted maxWarmContainerUses sandboxes
+// or their deadline is too close for another sandbox.
+type warmPool struct {
+	apiClient *client.Client
+	labels    func(deadline time.Time) map[string]string // Labels of a new container reaped after the deadline
+
+	mu        sync.Mutex
+	sizes     map[Language]int
+	idle      map[Language][]string // IDs of the idle containers, oldest first
+	uses      map[string]int        // Sandboxes hosted so far by container ID
+	deadlines map[string]time.Time  // Deadline in the labels by container ID
+	stats     map[Language]*WarmPoolStats
+}
+
+// newWarmPool creates a warm pool keeping the given number of idle containers per language, created with the labels.
+func newWarmPool(apiClient *client.Client, sizes map[Language]int, labels func(deadline time.Time) map[string]string) *warmPool {
+	w := &warmPool{
+		apiClient: apiClient,
+		labels:    labels,
+		sizes:     map[Language]int{},
+		idle:      map[Language][]string{},
+		uses:      map[string]int{},
+		deadlines: map[string]time.Time{},
+		stats:     map[Language]*WarmPoolStats{},
+	}
+	for language, size := range sizes {
+		if size > 0 {
+			w.sizes[language] = size
+			w.stats[language] = &WarmPoolStats{Size: size}
+		}
+	}
+	return w
+}
+
+// take removes the oldest idle container of the language whose deadline is after the given one from the pool, if there is one.
+func (w *warmPool) take(language Language, deadline time.Time) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats, ok := w.stats[language]
+	if !ok {
+		return "", false
+	}
+
+	idle := w.idle[language]
+	for i, containerID := range idle {
+		if w.deadlines[containerID].After(deadline) {
+			w.idle[language] = append(idle[:i:i], idle[i+1:]...)
+			stats.Hits++
+			return containerID, true
+		}
+	}
+
+	stats.Misses++
+	return "", false
+}
+
+// reset resets the container of a finished sandbox for the next one.
+// It reports false when the container is not worth keeping and has to be removed.
+func (w *warmPool) reset(ctx context.Context, sandbox *Sandbox) bool {
+	w.mu.Lock()
+	w.uses[sandbox.ID]++
+	keep := w.uses[sandbox.ID] < maxWarmContainerUses && len(w.idle[sandbox.Language]) < w.sizes[sandbox.Language] && !w.expiring(sandbox.ID)
+	w.mu.Unlock()
+
+	if !keep {
+		w.forget(sandbox.ID)
+		return false
+	}
+
+	if err := resetContainer(ctx, w.apiClient, sandbox.ID); err != nil {
+		log.Printf("Failed to reset Docker container: %v", err)
+		w.forget(sandbox.ID)
+		return false
+	}
+	return true
+}
+
+// recycle returns a reset container to the pool, reporting false when the pool of its language is already full.
+func (w *warmPool) recycle(language Language, containerID string) bool {
+	if !w.add(language, containerID, time.Time{}) {
+		w.forget(containerID)
+		return false
+	}
+
+	w.mu.Lock()
+	w.stats[language].Recycled++
+	w.mu.Unlock()
+	return true
+}
+
+// add puts the idle container in the pool unless the pool of its language is already full.
+// A zero deadline keeps the deadline the container had in the pool before.
+func (w *warmPool) add(language Language, containerID string, deadline time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.idle[language]) >= w.sizes[language] {
+		return false
+	}
+	w.idle[language] = append(w.idle[language], containerID)
+	if !deadline.IsZero() {
+		w.deadlines[containerID] = deadline
+	}
+	return true
+}
+
+// expiring reports whether the deadline of the container is too close for another sandbox. The caller holds the lock.
+func (w *warmPool) expiring(containerID string) bool {
+	return time.Until(w.deadlines[containerID]) < SandboxDeadline
+}
+
+// remove drops the idle container from the pool, reporting whether it was there.
+func (w *warmPool) remove(language Language, containerID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	idle := w.idle[language]
+	for i, id := range idle {
+		if id == containerID {
+			w.idle[language] = append(idle[:i:i], idle[i+1:]...)
+			delete(w.uses, containerID)
+			delete(w.deadlines, containerID)
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the container is idle in the pool.
+func (w *warmPool) contains(containerID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, ids := range w.idle {
+		for _, id := range ids {
+			if id == containerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forget stops tracking a container that is about to be removed.
+func (w *warmPool) forget(containerID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.uses, containerID)
+	delete(w.deadlines, containerID)
+}
+
+// fill starts containers until every language has its number of idle containers.
+func (w *warmPool) fill(ctx context.Context) {
+	w.mu.Lock()
+	missing := map[Language]int{}
+	for language, size := range w.sizes {
+		missing[language] = size - len(w.idle[language])
+	}
+	w.mu.Unlock()
+
+	for language, count := range missing {
+		spec, err := lookupLanguage(language)
+		if err != nil {
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			deadline := time.Now().Add(warmContainerLifetime)
+			containerID, err := startSandboxContainer(ctx, w.apiClient, spec, spec.DefaultResources(), w.labels(deadline))
+			if err != nil {
+				log.Printf("Failed to start warm Docker container: %v", err)
+				break
+			}
+			if !w.add(language, containerID, deadline) {
+				// Recycled containers filled the pool in the meantime
+				removeContainer(ctx, w.apiClient, containerID)
+				break
+			}
+		}
+	}
+}
+
+// check removes idle containers that are no longer running, and those whose deadline is too close for another sandbox.
+func (w *warmPool) check(ctx context.Context) {
+	w.mu.Lock()
+	idle := map[Language][]string{}
+	var expiring []string
+	for language, ids := range w.idle {
+		idle[language] = append([]string(nil), ids...)
+		for _, containerID := range ids {
+			if w.expiring(containerID) {
+				expiring = append(expiring, containerID)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	for language, ids := range idle {
+		for _, containerID := range ids {
+			if slices.Contains(expiring, containerID) {
+				// Replaced before other runners may reap it while it hosts a sandbox
+				if w.remove(language, containerID) {
+					if err := removeContainer(ctx, w.apiClient, containerID); err != nil && !client.IsErrNotFound(err) {
+						log.Printf("Failed to remove Docker container: %v", err)
+					}
+				}
+				continue
+			}
+
+			inspect, err := w.apiClient.ContainerInspect(ctx, containerID)
+			if err == nil && inspect.State != nil && inspect.State.Running {
+				continue
+			}
+			if !w.remove(language, containerID) {
+				continue // Taken by a sandbox while it was inspected
+			}
+
+			log.Printf("Removing unhealthy warm Docker container %s of %s", containerID, language)
+			w.mu.Lock()
+			w.stats[language].Unhealthy++
+			w.mu.Unlock()
+			if err := removeContainer(ctx, w.apiClient, containerID); err != nil && !client.IsErrNotFound(err) {
+				log.Printf("Failed to remove Docker container: %v", err)
+			}
+		}
+	}
+}
+
+// drain removes every idle container.
+func (w *warmPool) drain(ctx context.Context) {
+	w.mu.Lock()
+	idle := w.idle
+	w.idle = map[Language][]string{}
+	w.mu.Unlock()
+
+	for _, ids := range idle {
+		for _, containerID := range ids {
+			w.forget(containerID)
+			if err := removeContainer(ctx, w.apiClient, containerID); err != nil {
+				log.Printf("Failed to remove Docker container: %v", err)
+			}
+		}
+	}
+}
+
+// monitor fills the pool and replaces unhealthy containers until the context is done, then drains the pool.
+func (w *warmPool) monitor(ctx context.Context) {
+	w.fill(ctx)
+
+	ticker := time.NewTicker(warmPoolCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.drain(context.Background())
+			return
+		case <-ticker.C:
+			w.check(ctx)
+			w.fill(ctx)
+		}
+	}
+}
+
+// snapshot returns the stats of every language in the pool.
+func (w *warmPool) snapshot() map[Language]WarmPoolStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := make(map[Language]WarmPoolStats, len(w.stats))
+	for language, s := range w.stats {
+		snapshot := *s
+		snapshot.Idle = len(w.idle[language])
+		stats[language] = snapshot
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package rce
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWarmPoolTake(t *testing.T) {
+	pool := newWarmPool(nil, map[Language]int{C: 2}, nil)
+	now := time.Now()
+	pool.add(C, "soon", now.Add(time.Minute))
+	pool.add(C, "later", now.Add(time.Hour))
+
+	// Containers whose deadline comes before the one of the sandbox are skipped
+	if id, ok := pool.take(C, now.Add(30*time.Minute)); !ok || id != "later" {
+		t.Fatalf("take() = %q, %v, want the container with the later deadline", id, ok)
+	}
+	if id, ok := pool.take(C, now.Add(30*time.Minute)); ok {
+		t.Fatalf("take() = %q, want no container", id)
+	}
+	if _, ok := pool.take(PYTHON, now); ok {
+		t.Fatal("take() returned a container of a language without a pool")
+	}
+
+	want := map[Language]WarmPoolStats{C: {Size: 2, Idle: 1, Hits: 1, Misses: 1}}
+	if got := pool.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWarmPoolAddKeepsSize(t *testing.T) {
+	pool := newWarmPool(nil, map[Language]int{C: 1}, nil)
+	deadline := time.Now().Add(time.Hour)
+
+	if !pool.add(C, "first", deadline) {
+		t.Fatal("add() rejected a container of a pool with room for it")
+	}
+	if pool.add(C, "second", deadline) {
+		t.Fatal("add() accepted a container of a full pool")
+	}
+	if !pool.contains("first") || pool.contains("second") {
+		t.Fatal("the pool does not hold exactly the container it accepted")
+	}
+
+	if !pool.remove(C, "first") || pool.remove(C, "first") {
+		t.Fatal("remove() does not report whether the container was in the pool")
+	}
+	if !pool.recycle(C, "first") || pool.snapshot()[C].Recycled != 1 {
+		t.Fatalf("recycle() did not count the container: %+v", pool.snapshot()[C])
+	}
+}
+
+func TestWarmPoolResetDropsWornContainers(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		setup func(pool *warmPool)
+	}{
+		{
+			name: "used up",
+			setup: func(pool *warmPool) {
+				pool.deadlines["used"] = deadline
+				pool.uses["used"] = maxWarmContainerUses - 1
+			},
+		},
+		{
+			name: "pool full",
+			setup: func(pool *warmPool) {
+				pool.deadlines["used"] = deadline
+				pool.add(C, "idle", deadline)
+			},
+		},
+		{
+			name: "deadline too close",
+			setup: func(pool *warmPool) {
+				pool.deadlines["used"] = time.Now().Add(SandboxDeadline / 2)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := newWarmPool(nil, map[Language]int{C: 1}, nil)
+			test.setup(pool)
+
+			// Containers not worth keeping are dropped before they are reset, so no Docker host is needed
+			if pool.reset(context.Background(), &Sandbox{ID: "used", Language: C}) {
+				t.Fatal("reset() kept the container")
+			}
+			if _, ok := pool.uses["used"]; ok {
+				t.Fatal("reset() kept tracking the dropped container")
+			}
+		})
+	}
+}
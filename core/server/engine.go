@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"kiit-lab-engine/core/rce"
+)
+
+// imageRetryInterval is how long the server waits before fetching missing runner images again.
+const imageRetryInterval = 30 * time.Second
+
+// loadLanguageRegistry replaces the built-in languages with the registry at RCE_LANGUAGES, if set.
+func loadLanguageRegistry() error {
+	languagesPath := viper.GetString("RCE_LANGUAGES")
+	if languagesPath == "" {
+		return nil
+	}
+
+	registry, err := rce.LoadRegistry(languagesPath)
+	if err != nil {
+		return err
+	}
+	rce.SetDefaultRegistry(registry)
+	return nil
+}
+
+// imageSource returns where missing runner images are fetched from.
+func imageSource() rce.ImageSource {
+	return rce.ImageSource{
+		Registry:   viper.GetString("RCE_IMAGE_REGISTRY"),
+		TarballDir: viper.GetString("RCE_IMAGE_TARBALLS"),
+	}
+}
+
+// prepareEngine marks the engine ready once the runner can judge every registered language.
+// The Docker runner starts its reaper, retries fetching missing images until they are all present and then starts its warm pool.
+func prepareEngine(ctx context.Context, runner rce.Runner) {
+	dockerRunner, ok := runner.(*rce.DockerRunner)
+	if !ok {
+		rce.SetReadiness(rce.Readiness{Ready: true})
+		return
+	}
+
+	// Remove containers left behind by a previous crash before creating new ones
+	dockerRunner.StartReaper(ctx)
+
+	for {
+		images, err := dockerRunner.PrepareImages(ctx, imageSource())
+		if err == nil {
+			for _, image := range images {
+				log.Printf("Runner image %s for %s: %s", image.Image, image.Language, image.Version)
+			}
+			// The warm pool must be set up before any job can use the runner
+			dockerRunner.StartWarmPool(ctx, rce.DefaultRegistry().WarmPoolSizes())
+			rce.SetReadiness(rce.Readiness{Ready: true, Images: images})
+			return
+		}
+		rce.SetReadiness(rce.Readiness{Images: images})
+		log.Printf("Judge not ready: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(imageRetryInterval):
+		}
+	}
+}
+
+// PrepareImages verifies the runner image of every registered language, fetching missing ones, and prints the toolchain versions.
+func PrepareImages() error {
+	if err := loadLanguageRegistry(); err != nil {
+		return fmt.Errorf("failed to load language registry: %w", err)
+	}
+
+	runner, err := rce.NewDockerRunner()
+	if err != nil {
+		return err
+	}
+
+	images, err := runner.PrepareImages(context.Background(), imageSource())
+	for _, image := range images {
+		switch {
+		case image.Error != "":
+			fmt.Printf("%-10s %-20s error: %s\n", image.Language, image.Image, image.Error)
+		case image.Fetched:
+			fmt.Printf("%-10s %-20s fetched  %s\n", image.Language, image.Image, image.Version)
+		default:
+			fmt.Printf("%-10s %-20s present  %s\n", image.Language, image.Image, image.Version)
+		}
+	}
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os/signal"
 	"syscall"
@@ -12,9 +13,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 
+	"kiit-lab-engine/core/rce"
 	"kiit-lab-engine/db"
 	"kiit-lab-engine/lib/jwt"
 	"kiit-lab-engine/routes"
+	"kiit-lab-engine/service"
+)
+
+const (
+	httpShutdownTimeout  = 5 * time.Second  // How long shutdown waits for the requests in flight before cancelling them
+	judgeShutdownTimeout = 30 * time.Second // How long shutdown waits for the judge jobs in flight before cancelling them
+	defaultCacheSize     = 1 << 30          // 1GB of compiled artifacts
 )
 
 // StartServer initializes and starts the server
@@ -60,10 +69,50 @@ func StartServer() error {
 	}
 	defer dbClient.Disconnect()
 
+	// Load the language registry, falling back to the built-in languages
+	if err := loadLanguageRegistry(); err != nil {
+		log.Fatalf("failed to load language registry: %v", err)
+	}
+
+	// Initialize the code runner backend (docker or process)
+	runner, err := rce.NewRunner(viper.GetString("RCE_RUNNER"))
+	if err != nil {
+		log.Fatalf("failed to create code runner: %v", err)
+	}
+	rce.SetDefaultRunner(runner)
+
+	// Judge nothing until the runner has its images, then keep warm containers ready
+	engineCtx, stopEngine := context.WithCancel(context.Background())
+	defer stopEngine()
+	go prepareEngine(engineCtx, runner)
+
+	// Bound the number of sandboxes running at once, defaulting to one per CPU
+	if maxConcurrency := viper.GetInt("RCE_MAX_CONCURRENCY"); maxConcurrency > 0 {
+		rce.SetDefaultPool(rce.NewPool(maxConcurrency))
+	}
+
+	// Cache compiled artifacts on disk when a cache directory is configured
+	if cacheDir := viper.GetString("RCE_CACHE_DIR"); cacheDir != "" {
+		cacheSize := viper.GetInt64("RCE_CACHE_SIZE")
+		if cacheSize <= 0 {
+			cacheSize = defaultCacheSize
+		}
+		cache, err := rce.NewArtifactCache(cacheDir, cacheSize)
+		if err != nil {
+			log.Fatalf("failed to open artifact cache: %v", err)
+		}
+		rce.SetDefaultArtifactCache(cache)
+	}
+
+	// Cap the bytes captured from stdout and stderr of runs of questions that set no output limit
+	judgeConfig := service.JudgeConfig{
+		OutputLimit: viper.GetInt64("RCE_OUTPUT_LIMIT"),
+	}
+
 	// Initialize Gin router
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
-	routes.InitRoutes(r, dbClient, jwtManager)
+	judgeService := routes.InitRoutes(r, dbClient, jwtManager, judgeConfig)
 
 	// Get port from configuration or default to 8421
 	port := viper.GetString("PORT")
@@ -71,10 +120,15 @@ func StartServer() error {
 		port = "8421"
 	}
 
+	// Requests get a context cancelled when shutdown runs out of time, which stops the sample runs they started
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	// Create the HTTP server
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: r,
+		Addr:        fmt.Sprintf(":%s", port),
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
 	}
 
 	// Create a context that listens for the interrupt signal from the OS
@@ -82,28 +136,44 @@ func StartServer() error {
 	defer stop()
 
 	// Start the server in a goroutine
+	listenErr := make(chan error, 1)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+			listenErr <- err
 		}
 	}()
 
-	// Listen for the interrupt signal
-	<-ctx.Done()
+	// Listen for the interrupt signal, or the server failing to listen
+	var serverErr error
+	select {
+	case <-ctx.Done():
+	case serverErr = <-listenErr:
+		log.Printf("listen: %s", serverErr)
+	}
 
 	// Restore default behavior on the interrupt signal and notify user of shutdown
 	stop()
 	log.Println("shutting down gracefully, press Ctrl+C again to force")
 
 	// Create a context with a timeout to allow ongoing requests to finish
-	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
 	defer cancel()
 
-	// Shutdown the server gracefully
+	// Shutdown the server gracefully, cancelling the requests still running at the deadline
 	if err := srv.Shutdown(ctxShutdown); err != nil {
-		log.Fatal("Server forced to shutdown: ", err)
+		log.Printf("Server forced to shutdown: %v", err)
+		cancelRequests()
+		srv.Close()
+	}
+
+	// Let the judge jobs in flight finish, cancelling those still running at the deadline
+	ctxJobs, cancelJobs := context.WithTimeout(context.Background(), judgeShutdownTimeout)
+	defer cancelJobs()
+
+	if err := judgeService.Shutdown(ctxJobs); err != nil {
+		log.Printf("judge jobs cancelled and requeued: %v", err)
 	}
 
 	log.Println("Server exiting")
-	return nil
+	return serverErr
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"kiit-lab-engine/core/server"
 	"log"
+	"os"
 
 	"github.com/spf13/viper"
 )
@@ -15,6 +16,14 @@ func init() {
 }
 
 func main() {
+	// `images` verifies and fetches the runner images without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "images" {
+		if err := server.PrepareImages(); err != nil {
+			log.Fatalf("Runner images are not ready: %v", err)
+		}
+		return
+	}
+
 	if err := server.StartServer(); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"kiit-lab-engine/lib/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the claims of the access token set on the context of authenticated requests.
+const (
+	UserIDKey = "user_id"
+	RoleKey   = "role"
+)
+
+// AuthMiddleware lets through requests with a valid access token, from the access_token cookie set at login
+// or an Authorization bearer header, and sets the user ID and the role it carries on the context.
+func AuthMiddleware(jwtManager *jwt.JWTManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie("access_token")
+		if err != nil || token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing access token"})
+			return
+		}
+
+		claims, err := jwtManager.Verify(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		userID, ok := claims[UserIDKey].(string)
+		if !ok || userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user_id not found"})
+			return
+		}
+		role, _ := claims[RoleKey].(string)
+
+		c.Set(UserIDKey, userID)
+		c.Set(RoleKey, role)
+		c.Next()
+	}
+}
+
+// RequireRole lets through authenticated requests of users with the role. It must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(RoleKey) != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// UserID returns the ID of the user of an authenticated request.
+func UserID(c *gin.Context) string {
+	return c.GetString(UserIDKey)
+}
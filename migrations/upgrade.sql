@@ -0,0 +1,66 @@
+-- Brings a database created from an older schema.prisma to a shape `db push` can apply the current one to
+-- without losing data. Every step checks that it is still needed, so the script can run before each push.
+
+-- Questions had one expected output shared by all test cases, they now have one per test case
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'Question' AND column_name = 'expectedOutput'
+    ) THEN
+        ALTER TABLE "Question" ADD COLUMN IF NOT EXISTS "expectedOutputs" TEXT[];
+        UPDATE "Question"
+        SET "expectedOutputs" = array_fill("expectedOutput", ARRAY[coalesce(cardinality("testCases"), 0)])
+        WHERE "expectedOutputs" IS NULL OR cardinality("expectedOutputs") = 0;
+        ALTER TABLE "Question" DROP COLUMN "expectedOutput";
+    END IF;
+END $$;
+
+-- Languages were a LANGUAGE enum, they are now identifiers from the rce language registry, which are lower case
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'Question' AND column_name = 'allowed_language' AND udt_name = '_LANGUAGE'
+    ) THEN
+        ALTER TABLE "Question" ALTER COLUMN "allowed_language" TYPE TEXT[]
+            USING string_to_array(lower(array_to_string("allowed_language", ',')), ',');
+    END IF;
+
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'Submission' AND column_name = 'language' AND udt_name = 'LANGUAGE'
+    ) THEN
+        ALTER TABLE "Submission" ALTER COLUMN "language" TYPE TEXT USING lower("language"::TEXT);
+    END IF;
+END $$;
+
+DROP TYPE IF EXISTS "LANGUAGE";
+
+-- Test cases are stored on their question, the TestCase table was never used
+DROP TABLE IF EXISTS "TestCase";
+
+-- Judge jobs now belong to their user and question and are judged the way the question judges code.
+-- Jobs from before cannot be tied to either and are dropped, their copies of the question go with the columns.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'JudgeJob')
+        AND NOT EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_schema = current_schema() AND table_name = 'JudgeJob' AND column_name = 'questionId'
+        )
+    THEN
+        DELETE FROM "JudgeJob";
+    END IF;
+END $$;
+
+ALTER TABLE IF EXISTS "JudgeJob"
+    DROP COLUMN IF EXISTS "inputs",
+    DROP COLUMN IF EXISTS "expectedOutputs",
+    DROP COLUMN IF EXISTS "checker",
+    DROP COLUMN IF EXISTS "function",
+    DROP COLUMN IF EXISTS "interactor",
+    DROP COLUMN IF EXISTS "requireLeakFree",
+    DROP COLUMN IF EXISTS "memcheck",
+    DROP COLUMN IF EXISTS "compilerFlags",
+    DROP COLUMN IF EXISTS "limits";
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kiit-lab-engine/db"
+)
+
+// ErrJobNotFound is returned for a judge job that does not exist.
+var ErrJobNotFound = errors.New("judge job not found")
+
+// ErrLeaseLost is returned for a judge job whose lease expired and that another instance may have claimed since.
+var ErrLeaseLost = errors.New("judge job is no longer owned by this instance")
+
+type JudgeJobRepository interface {
+	CreateJob(ctx context.Context, job NewJudgeJobInput) (*db.JudgeJobModel, error)
+	GetJobFromId(ctx context.Context, id string) (*db.JudgeJobModel, error)
+	ClaimNextJob(ctx context.Context, owner string, leaseExpiresAt time.Time) (*db.JudgeJobModel, JobLease, error)
+	RenewLease(ctx context.Context, lease JobLease, leaseExpiresAt time.Time) error
+	UpdateJobStatus(ctx context.Context, lease JobLease, status db.JudgeJobStatus) error
+	ReleaseJob(ctx context.Context, lease JobLease) error
+	FinishJob(ctx context.Context, lease JobLease, result []byte, jobErr error) error
+	RequeueExpiredJobs(ctx context.Context) (int, error)
+}
+
+type judgeJobRepository struct {
+	db *db.DBClient
+}
+
+func NewJudgeJobRepository(db *db.DBClient) JudgeJobRepository {
+	return &judgeJobRepository{
+		db: db,
+	}
+}
+
+type NewJudgeJobInput struct {
+	UserID     string // Who submitted the code
+	QuestionID string // Question the code answers, the job is judged the way it judges code
+	Language   string
+	Code       string
+}
+
+func (r *judgeJobRepository) CreateJob(ctx context.Context, job NewJudgeJobInput) (*db.JudgeJobModel, error) {
+	created, err := r.db.Prisma.JudgeJob.CreateOne(
+		db.JudgeJob.Language.Set(job.Language),
+		db.JudgeJob.Code.Set(job.Code),
+		db.JudgeJob.User.Link(
+			db.User.ID.Equals(job.UserID),
+		),
+		db.JudgeJob.Question.Link(
+			db.Question.ID.Equals(job.QuestionID),
+		),
+	).Exec(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create judge job: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetJobFromId returns the job with its question, the assignment of the question and the course of the assignment.
+func (r *judgeJobRepository) GetJobFromId(ctx context.Context, id string) (*db.JudgeJobModel, error) {
+	job, err := r.db.Prisma.JudgeJob.FindUnique(
+		db.JudgeJob.ID.Equals(id),
+	).With(
+		db.JudgeJob.Question.Fetch().With(
+			db.Question.Assignment.Fetch().With(
+				db.Assignment.Course.Fetch(),
+			),
+		),
+	).Exec(ctx)
+
+	if errors.Is(err, db.ErrNotFound) || (err == nil && job == nil) {
+		return nil, ErrJobNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get judge job: %w", err)
+	}
+
+	return job, nil
+}
+
+// claimNextJobQuery moves the oldest queued job to COMPILING for an owner with a lease and returns it.
+// Rows locked by a concurrent claim are skipped, so every job is claimed by one owner at a time.
+const claimNextJobQuery = `UPDATE "JudgeJob"
+SET "status" = 'COMPILING', "owner" = $1, "leaseExpiresAt" = CAST($2 AS timestamp(3)), "claim" = "claim" + 1, "updatedAt" = now()
+WHERE "id" = (
+	SELECT "id" FROM "JudgeJob"
+	WHERE "status" = 'QUEUED'
+	ORDER BY "createdAt"
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+
+// JobLease is one claim of a judge job by an owner. Writes under it fail with ErrLeaseLost once the job was queued again,
+// even if the same owner claimed it since.
+type JobLease struct {
+	ID    string
+	Owner string
+	Claim int // Claim of the job the lease was taken by, counted from 1
+}
+
+// ClaimNextJob moves the oldest queued job to COMPILING for the owner with a lease until the given time and returns it with the lease,
+// or nil when no job is queued.
+func (r *judgeJobRepository) ClaimNextJob(ctx context.Context, owner string, leaseExpiresAt time.Time) (*db.JudgeJobModel, JobLease, error) {
+	var jobs []db.JudgeJobModel
+	if err := r.db.Prisma.Prisma.QueryRaw(claimNextJobQuery, owner, leaseExpiresAt.UTC()).Exec(ctx, &jobs); err != nil {
+		return nil, JobLease{}, fmt.Errorf("failed to claim judge job: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		return nil, JobLease{}, nil
+	}
+
+	return &jobs[0], JobLease{ID: jobs[0].ID, Owner: owner, Claim: jobs[0].Claim}, nil
+}
+
+// leasedJob selects the job of the lease while it is being judged under it.
+func leasedJob(lease JobLease) []db.JudgeJobWhereParam {
+	return []db.JudgeJobWhereParam{
+		db.JudgeJob.ID.Equals(lease.ID),
+		db.JudgeJob.Owner.Equals(lease.Owner),
+		db.JudgeJob.Claim.Equals(lease.Claim),
+		db.JudgeJob.Status.In([]db.JudgeJobStatus{db.JudgeJobStatusCompiling, db.JudgeJobStatusRunning}),
+	}
+}
+
+// RenewLease extends the lease on the job being judged until the given time.
+// It returns ErrLeaseLost when the job is no longer being judged under the lease.
+func (r *judgeJobRepository) RenewLease(ctx context.Context, lease JobLease, leaseExpiresAt time.Time) error {
+	renewed, err := r.db.Prisma.JudgeJob.FindMany(
+		leasedJob(lease)...,
+	).Update(
+		db.JudgeJob.LeaseExpiresAt.Set(leaseExpiresAt),
+	).Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to renew judge job lease: %w", err)
+	}
+
+	if renewed.Count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// UpdateJobStatus moves the job being judged under the lease to COMPILING or RUNNING.
+// It returns ErrLeaseLost when the job is no longer being judged under the lease.
+func (r *judgeJobRepository) UpdateJobStatus(ctx context.Context, lease JobLease, status db.JudgeJobStatus) error {
+	if status != db.JudgeJobStatusCompiling && status != db.JudgeJobStatusRunning {
+		return fmt.Errorf("invalid judge job status for a leased job: %s", status)
+	}
+
+	updated, err := r.db.Prisma.JudgeJob.FindMany(
+		leasedJob(lease)...,
+	).Update(
+		db.JudgeJob.Status.Set(status),
+	).Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to update judge job: %w", err)
+	}
+
+	if updated.Count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseJob puts the job being judged under the lease back in the queue without an owner.
+// It returns ErrLeaseLost when the job is no longer being judged under the lease.
+func (r *judgeJobRepository) ReleaseJob(ctx context.Context, lease JobLease) error {
+	released, err := r.db.Prisma.JudgeJob.FindMany(
+		leasedJob(lease)...,
+	).Update(
+		db.JudgeJob.Status.Set(db.JudgeJobStatusQueued),
+		db.JudgeJob.Owner.Set(""),
+	).Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to release judge job: %w", err)
+	}
+
+	if released.Count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// FinishJob marks the job being judged under the lease done with its result, or with the error that stopped it from being judged.
+// It returns ErrLeaseLost when the job is no longer being judged under the lease.
+func (r *judgeJobRepository) FinishJob(ctx context.Context, lease JobLease, result []byte, jobErr error) error {
+	updateFields := []db.JudgeJobSetParam{
+		db.JudgeJob.Status.Set(db.JudgeJobStatusDone),
+	}
+
+	if result != nil {
+		updateFields = append(updateFields, db.JudgeJob.Result.Set(db.JSON(result)))
+	}
+	if jobErr != nil {
+		updateFields = append(updateFields, db.JudgeJob.Error.Set(jobErr.Error()))
+	}
+
+	finished, err := r.db.Prisma.JudgeJob.FindMany(
+		leasedJob(lease)...,
+	).Update(
+		updateFields...,
+	).Exec(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to finish judge job: %w", err)
+	}
+
+	if finished.Count == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// RequeueExpiredJobs puts jobs whose owner stopped renewing their lease, because it crashed or lost the database, back in the queue.
+// Jobs still being judged keep a lease in the future and are left alone; the old owner can no longer write to requeued ones.
+func (r *judgeJobRepository) RequeueExpiredJobs(ctx context.Context) (int, error) {
+	requeued, err := r.db.Prisma.JudgeJob.FindMany(
+		db.JudgeJob.Status.In([]db.JudgeJobStatus{db.JudgeJobStatusCompiling, db.JudgeJobStatusRunning}),
+		db.JudgeJob.LeaseExpiresAt.Lt(time.Now()),
+	).Update(
+		db.JudgeJob.Status.Set(db.JudgeJobStatusQueued),
+		db.JudgeJob.Owner.Set(""),
+	).Exec(ctx)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue judge jobs: %w", err)
+	}
+
+	return requeued.Count, nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"kiit-lab-engine/db"
+)
+
+// ErrQuestionNotFound is returned for a question that does not exist.
+var ErrQuestionNotFound = errors.New("question not found")
+
+type QuestionRepository interface {
+	GetQuestionFromId(ctx context.Context, id string) (*db.QuestionModel, error)
+	CreateQuestion(ctx context.Context, question NewQuestionInput) (*db.QuestionModel, error)
+}
+
+type questionRepository struct {
+	db *db.DBClient
+}
+
+func NewQuestionRepository(db *db.DBClient) QuestionRepository {
+	return &questionRepository{
+		db: db,
+	}
+}
+
+func (r *questionRepository) GetQuestionFromId(ctx context.Context, id string) (*db.QuestionModel, error) {
+	question, err := r.db.Prisma.Question.FindUnique(
+		db.Question.ID.Equals(id),
+	).With(
+		db.Question.InputVariables.Fetch().OrderBy(
+			db.InputVariable.Position.Order(db.SortOrderAsc),
+		),
+	).Exec(ctx)
+
+	if errors.Is(err, db.ErrNotFound) || (err == nil && question == nil) {
+		return nil, ErrQuestionNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get question: %w", err)
+	}
+
+	return question, nil
+}
+
+type NewQuestionInput struct {
+	AssignmentID     string
+	Que              string
+	TotalMarks       int
+	AllowedLanguages []string // Identifiers from the rce language registry
+	FunctionName     string
+	InputVariables   []NewInputVariable // Parameters of the function, in order
+	ReturnType       string             // rce.ValueType the function returns, empty for void
+	TestCases        []string
+	ExpectedOutputs  []string // One per test case
+	SampleTests      int      // Number of test cases, from the first, shown to students
+	Checker          []byte   // JSON encoded rce.CheckerSpec, nil compares outputs exactly
+	Interactor       []byte   // JSON encoded rce.InteractorSpec, nil when the question is not interactive
+	Flags            []byte   // JSON encoded rce.CompilerFlags, nil when the compile command of the language is used as is
+	RequireLeakFree  bool
+
+	// Resource limits of submissions, 0 keeps the default of their language
+	TimeLimitMs   int
+	MemoryLimitMb int
+	ProcessLimit  int
+	OutputLimitKb int
+	CPUShare      float64
+}
+
+type NewInputVariable struct {
+	Name string
+	Type string // rce.ValueType, empty for string
+}
+
+func (r *questionRepository) CreateQuestion(ctx context.Context, question NewQuestionInput) (*db.QuestionModel, error) {
+	optionalFields := []db.QuestionSetParam{
+		db.Question.AllowedLanguage.Set(question.AllowedLanguages),
+		db.Question.TestCases.Set(question.TestCases),
+		db.Question.ExpectedOutputs.Set(question.ExpectedOutputs),
+		db.Question.SampleTests.Set(question.SampleTests),
+		db.Question.RequireLeakFree.Set(question.RequireLeakFree),
+	}
+
+	if question.ReturnType != "" {
+		optionalFields = append(optionalFields, db.Question.ReturnType.Set(question.ReturnType))
+	}
+	if question.Checker != nil {
+		optionalFields = append(optionalFields, db.Question.Checker.Set(db.JSON(question.Checker)))
+	}
+	if question.Interactor != nil {
+		optionalFields = append(optionalFields, db.Question.Interactor.Set(db.JSON(question.Interactor)))
+	}
+	if question.Flags != nil {
+		optionalFields = append(optionalFields, db.Question.CompilerFlags.Set(db.JSON(question.Flags)))
+	}
+	if question.TimeLimitMs > 0 {
+		optionalFields = append(optionalFields, db.Question.TimeLimitMs.Set(question.TimeLimitMs))
+	}
+	if question.MemoryLimitMb > 0 {
+		optionalFields = append(optionalFields, db.Question.MemoryLimitMb.Set(question.MemoryLimitMb))
+	}
+	if question.ProcessLimit > 0 {
+		optionalFields = append(optionalFields, db.Question.ProcessLimit.Set(question.ProcessLimit))
+	}
+	if question.OutputLimitKb > 0 {
+		optionalFields = append(optionalFields, db.Question.OutputLimitKb.Set(question.OutputLimitKb))
+	}
+	if question.CPUShare > 0 {
+		optionalFields = append(optionalFields, db.Question.CPUShare.Set(question.CPUShare))
+	}
+
+	created, err := r.db.Prisma.Question.CreateOne(
+		db.Question.TotalMarks.Set(question.TotalMarks),
+		db.Question.Que.Set(question.Que),
+		db.Question.FunctionName.Set(question.FunctionName),
+		db.Question.Assignment.Link(
+			db.Assignment.ID.Equals(question.AssignmentID),
+		),
+		optionalFields...,
+	).Exec(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create question: %w", err)
+	}
+
+	if err := r.createInputVariables(ctx, created.ID, question.InputVariables); err != nil {
+		// A question missing some of its parameters would judge every submission wrong
+		if _, err := r.db.Prisma.Question.FindUnique(
+			db.Question.ID.Equals(created.ID),
+		).Delete().Exec(ctx); err != nil {
+			log.Printf("Failed to delete question %s: %v", created.ID, err)
+		}
+		return nil, err
+	}
+
+	return r.GetQuestionFromId(ctx, created.ID)
+}
+
+// createInputVariables creates the parameters of the function of the question in one transaction, numbered in order.
+func (r *questionRepository) createInputVariables(ctx context.Context, questionID string, variables []NewInputVariable) error {
+	if len(variables) == 0 {
+		return nil
+	}
+
+	creates := make([]db.PrismaTransaction, 0, len(variables))
+	for i, variable := range variables {
+		optionalFields := []db.InputVariableSetParam{
+			db.InputVariable.Position.Set(i),
+			db.InputVariable.Question.Link(
+				db.Question.ID.Equals(questionID),
+			),
+		}
+		if variable.Type != "" {
+			optionalFields = append(optionalFields, db.InputVariable.Type.Set(variable.Type))
+		}
+
+		creates = append(creates, r.db.Prisma.InputVariable.CreateOne(
+			db.InputVariable.Name.Set(variable.Name),
+			optionalFields...,
+		).Tx())
+	}
+
+	if err := r.db.Prisma.Prisma.Transaction(creates...).Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create input variables: %w", err)
+	}
+
+	return nil
+}
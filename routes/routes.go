@@ -1,23 +1,40 @@
 package routes
 
 import (
+	"context"
+	"log"
+
 	"kiit-lab-engine/controllers"
+	"kiit-lab-engine/core/rce"
 	"kiit-lab-engine/db"
 	"kiit-lab-engine/lib/jwt"
+	"kiit-lab-engine/middleware"
 	"kiit-lab-engine/repository"
 	"kiit-lab-engine/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitRoutes(r *gin.Engine, dbClient *db.DBClient, jwtManager *jwt.JWTManager) {
+// InitRoutes registers every route and returns the judge service so the server can stop its workers on shutdown.
+func InitRoutes(r *gin.Engine, dbClient *db.DBClient, jwtManager *jwt.JWTManager, judgeConfig service.JudgeConfig) service.JudgeService {
 	userRepo := repository.NewUserRepository(dbClient)
+	judgeRepo := repository.NewJudgeJobRepository(dbClient)
+	questionRepo := repository.NewQuestionRepository(dbClient)
 
 	userService := service.NewUserService(userRepo)
 	authService := service.NewAuthService(userRepo, jwtManager)
+	questionService := service.NewQuestionService(questionRepo)
+	judgeService := service.NewJudgeService(judgeRepo, questionRepo, judgeConfig)
+
+	// One worker per pool slot, so queued jobs wait in the database rather than in memory
+	if err := judgeService.StartWorkers(context.Background(), rce.DefaultPool().Stats().Size); err != nil {
+		log.Fatalf("failed to start judge workers: %v", err)
+	}
 
 	authController := controllers.NewAuthController(authService)
 	userController := controllers.NewUserController(userService)
+	questionController := controllers.NewQuestionController(questionService)
+	judgeController := controllers.NewJudgeController(judgeService)
 
 	auth := r.Group("/auth")
 	auth.POST("/register", authController.Register)
@@ -25,4 +42,22 @@ func InitRoutes(r *gin.Engine, dbClient *db.DBClient, jwtManager *jwt.JWTManager
 
 	user := r.Group("/user")
 	user.GET("/:id", userController.GetUser)
+
+	requireAuth := middleware.AuthMiddleware(jwtManager)
+
+	question := r.Group("/question", requireAuth)
+	question.POST("", middleware.RequireRole(string(db.RoleTeacher)), questionController.CreateQuestion)
+	question.GET("/:id", questionController.GetQuestion)
+
+	// Readiness is probed by the orchestrator, which has no token
+	r.GET("/judge/ready", judgeController.Ready)
+
+	judge := r.Group("/judge", requireAuth)
+	judge.POST("", judgeController.Submit)
+	judge.POST("/run", judgeController.Run)
+	judge.GET("/stats", judgeController.Stats)
+	judge.GET("/:id", judgeController.GetStatus)
+	judge.GET("/:id/result", judgeController.GetResult)
+
+	return judgeService
 }
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"kiit-lab-engine/core/rce"
+	"kiit-lab-engine/db"
+	"kiit-lab-engine/repository"
+)
+
+const (
+	judgePollInterval       = 2 * time.Second // How often idle workers look for jobs queued by other instances or left over from a restart
+	judgeLease              = time.Minute     // How long a claimed job stays with its instance without a renewal before it is queued again
+	judgeLeaseRenewInterval = judgeLease / 3
+)
+
+// ErrInvalidSubmission is wrapped by the errors of code that cannot be judged as submitted,
+// like code in a language the question does not allow or run modes that cannot be combined.
+var ErrInvalidSubmission = errors.New("invalid submission")
+
+// ErrJudgeNotReady is returned for runs while the engine is not ready to judge code.
+var ErrJudgeNotReady = errors.New("judge is not ready")
+
+type JudgeService interface {
+	Submit(ctx context.Context, input SubmitJudgeInput) (*db.JudgeJobModel, error)
+	GetJob(ctx context.Context, id string, userID string) (*db.JudgeJobModel, error)
+	Run(ctx context.Context, input SubmitJudgeInput) (rce.JobResult, error)
+	StartWorkers(ctx context.Context, workers int) error
+	Shutdown(ctx context.Context) error
+	Readiness() rce.Readiness
+	Stats() rce.Stats
+}
+
+// JudgeConfig is how the server configures judging.
+type JudgeConfig struct {
+	OutputLimit int64 // Bytes captured from each of stdout and stderr of runs of questions setting no output limit, the language default when zero
+}
+
+type judgeService struct {
+	judgeRepo    repository.JudgeJobRepository
+	questionRepo repository.QuestionRepository
+	config       JudgeConfig
+	instance     string // Owner of the jobs this instance claims
+	wake         chan struct{}
+
+	stop       chan struct{} // Closed when the workers must stop claiming jobs
+	stopOnce   sync.Once
+	workers    sync.WaitGroup
+	jobsCtx    context.Context // Context of the jobs being judged, cancelled when shutdown runs out of time
+	cancelJobs context.CancelFunc
+}
+
+func NewJudgeService(judgeRepo repository.JudgeJobRepository, questionRepo repository.QuestionRepository, config JudgeConfig) JudgeService {
+	return &judgeService{
+		judgeRepo:    judgeRepo,
+		questionRepo: questionRepo,
+		config:       config,
+		instance:     rce.NewID(),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+type SubmitJudgeInput struct {
+	UserID     string `json:"-"` // Who submits the code, from their access token
+	QuestionID string // Question the code answers, it must allow the language and decides how the code is judged
+	Code       string
+	Language   string
+	Inputs     []string // Custom inputs of a sample run, judged by no checker; the sample tests of the question when empty
+	Debug      bool     // Builds C and C++ code with sanitizers and reports their findings, for sample runs only
+	Memcheck   bool     // Runs C and C++ code under Valgrind memcheck, the result reports whether it was leak free, for sample runs only
+}
+
+// validate checks that the debug modes of the run can be combined, also with the memcheck runs of questions requiring leak-free code.
+func (input SubmitJudgeInput) validate(settings judgeSettings) error {
+	if input.Debug && (input.Memcheck || settings.requireLeakFree) {
+		return fmt.Errorf("%w: a judge job cannot be both a debug and a memcheck run", ErrInvalidSubmission)
+	}
+	return nil
+}
+
+// Submit queues the code to be judged against the test cases of the question and returns the job without waiting for it.
+func (j *judgeService) Submit(ctx context.Context, input SubmitJudgeInput) (*db.JudgeJobModel, error) {
+	settings, err := j.judgeSettings(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := input.validate(settings); err != nil {
+		return nil, err
+	}
+	if input.Debug || input.Memcheck {
+		return nil, fmt.Errorf("%w: debug and memcheck runs are only available for sample runs", ErrInvalidSubmission)
+	}
+	if len(input.Inputs) > 0 {
+		return nil, fmt.Errorf("%w: custom inputs are only available for sample runs", ErrInvalidSubmission)
+	}
+
+	job, err := j.judgeRepo.CreateJob(ctx, repository.NewJudgeJobInput{
+		UserID:     input.UserID,
+		QuestionID: input.QuestionID,
+		Language:   string(settings.language),
+		Code:       input.Code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wake an idle worker, one pending wake up is enough as workers drain the queue
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+// GetJob returns the job to the user who submitted it or teaches the course of its question.
+// Anyone else gets repository.ErrJobNotFound, so they cannot tell which jobs exist.
+func (j *judgeService) GetJob(ctx context.Context, id string, userID string) (*db.JudgeJobModel, error) {
+	job, err := j.judgeRepo.GetJobFromId(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.UserID != userID && job.Question().Assignment().Course().TeacherID != userID {
+		return nil, repository.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Run judges the code against the sample tests of the question, or runs it with the custom inputs, right away and returns the result,
+// stopping the run when ctx is done. Hidden tests are only run by Submit.
+func (j *judgeService) Run(ctx context.Context, input SubmitJudgeInput) (rce.JobResult, error) {
+	settings, err := j.judgeSettings(ctx, input)
+	if err != nil {
+		return rce.JobResult{}, err
+	}
+	if err := input.validate(settings); err != nil {
+		return rce.JobResult{}, err
+	}
+
+	if !rce.CurrentReadiness().Ready {
+		return rce.JobResult{}, ErrJudgeNotReady
+	}
+
+	job := settings.job(input.Code, j.config)
+	job.Tests = job.Tests[:settings.samples]
+	if len(input.Inputs) > 0 {
+		// Custom inputs have no expected output to judge against
+		job.Tests, job.Checker = testCases(input.Inputs, nil), nil
+	}
+	job.Sanitize, job.Memcheck = input.Debug, input.Memcheck
+
+	return rce.RunJob(ctx, job)
+}
+
+// judgeSettings returns how the question the code answers judges code in its language.
+func (j *judgeService) judgeSettings(ctx context.Context, input SubmitJudgeInput) (judgeSettings, error) {
+	question, err := j.questionRepo.GetQuestionFromId(ctx, input.QuestionID)
+	if err != nil {
+		return judgeSettings{}, err
+	}
+	return newJudgeSettings(question, input.Language)
+}
+
+// Readiness returns whether submitted jobs are being judged.
+func (j *judgeService) Readiness() rce.Readiness {
+	return rce.CurrentReadiness()
+}
+
+// Stats returns the load on the engine and the work done by its background tasks.
+func (j *judgeService) Stats() rce.Stats {
+	return rce.CurrentStats()
+}
+
+// StartWorkers requeues jobs whose owner stopped renewing their lease, now and periodically, and starts the workers that judge
+// queued jobs until ctx is done or Shutdown is called.
+func (j *judgeService) StartWorkers(ctx context.Context, workers int) error {
+	j.jobsCtx, j.cancelJobs = context.WithCancel(ctx)
+
+	if err := j.requeueExpiredJobs(ctx); err != nil {
+		return err
+	}
+
+	j.workers.Add(1)
+	go func() {
+		defer j.workers.Done()
+
+		ticker := time.NewTicker(judgeLease)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				if err := j.requeueExpiredJobs(ctx); err != nil {
+					log.Printf("Failed to requeue judge jobs: %v", err)
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		j.workers.Add(1)
+		go func() {
+			defer j.workers.Done()
+			j.work(ctx)
+		}()
+	}
+
+	return nil
+}
+
+// requeueExpiredJobs puts the jobs of instances that stopped judging them back in the queue.
+func (j *judgeService) requeueExpiredJobs(ctx context.Context) error {
+	requeued, err := j.judgeRepo.RequeueExpiredJobs(ctx)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		log.Printf("Requeued %d interrupted judge jobs", requeued)
+	}
+	return nil
+}
+
+// Shutdown stops the workers from claiming jobs and waits for the jobs being judged to finish.
+// When ctx is done first the jobs are cancelled and queued again, to be judged after the restart.
+func (j *judgeService) Shutdown(ctx context.Context) error {
+	j.stopOnce.Do(func() { close(j.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		j.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	if j.cancelJobs != nil {
+		j.cancelJobs()
+	}
+	<-done
+	return ctx.Err()
+}
+
+// work judges queued jobs one at a time, waiting for new ones when the queue is empty.
+func (j *judgeService) work(ctx context.Context) {
+	ticker := time.NewTicker(judgePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+
+		// Jobs stay queued until the engine has everything it needs to judge them
+		if rce.CurrentReadiness().Ready {
+			job, lease, err := j.judgeRepo.ClaimNextJob(ctx, j.instance, time.Now().Add(judgeLease))
+			if err != nil {
+				log.Printf("Failed to claim judge job: %v", err)
+			}
+
+			if job != nil {
+				j.judge(ctx, job, lease)
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-j.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// judge runs the job claimed under the lease, as its question judges code, and stores its result.
+func (j *judgeService) judge(ctx context.Context, job *db.JudgeJobModel, lease repository.JobLease) {
+	question, err := j.questionRepo.GetQuestionFromId(ctx, job.QuestionID)
+	if err != nil && !errors.Is(err, repository.ErrQuestionNotFound) {
+		log.Printf("Failed to get question of judge job %s: %v", job.ID, err)
+		if err := j.judgeRepo.ReleaseJob(ctx, lease); err != nil {
+			log.Printf("Failed to requeue judge job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	var settings judgeSettings
+	if err == nil {
+		settings, err = newJudgeSettings(question, job.Language)
+	}
+	if err != nil {
+		if err := j.judgeRepo.FinishJob(ctx, lease, nil, err); err != nil {
+			log.Printf("Failed to finish judge job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	rceJob := settings.job(job.Code, j.config)
+	rceJob.OnStatus = func(status rce.JobStatus) {
+		if err := j.judgeRepo.UpdateJobStatus(ctx, lease, db.JudgeJobStatus(status)); err != nil {
+			log.Printf("Failed to update judge job %s: %v", job.ID, err)
+		}
+	}
+
+	jobCtx, cancelJob := context.WithCancel(j.jobsCtx)
+	defer cancelJob()
+
+	stopRenewing := j.renewLease(ctx, lease, cancelJob)
+	result, jobErr := rce.RunJob(jobCtx, rceJob)
+	stopRenewing()
+
+	// A job cancelled by shutdown is judged again after the restart, one whose lease was lost is left to its new owner
+	if errors.Is(jobErr, context.Canceled) {
+		if err := j.judgeRepo.ReleaseJob(ctx, lease); err != nil {
+			log.Printf("Failed to requeue judge job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	var raw []byte
+	if jobErr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			jobErr = err
+		} else {
+			raw = encoded
+		}
+	}
+
+	if err := j.judgeRepo.FinishJob(ctx, lease, raw, jobErr); err != nil {
+		log.Printf("Failed to finish judge job %s: %v", job.ID, err)
+	}
+}
+
+// renewLease keeps renewing the lease on the job until the returned function is called.
+// When the lease was lost, because renewals failed for longer than it lasts, the job is cancelled as another instance may judge it by now.
+func (j *judgeService) renewLease(ctx context.Context, lease repository.JobLease, cancelJob context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(judgeLeaseRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			err := j.judgeRepo.RenewLease(ctx, lease, time.Now().Add(judgeLease))
+			if errors.Is(err, repository.ErrLeaseLost) {
+				log.Printf("Lost the lease on judge job %s, cancelling it", lease.ID)
+				cancelJob()
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to renew lease on judge job %s: %v", lease.ID, err)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// job returns the job judging the code against every test case of the question, the way the question judges code.
+// The output limit of the config applies unless the question sets its own.
+func (s judgeSettings) job(code string, config JudgeConfig) rce.Job {
+	limits, resources := s.limits.ForLanguage(s.language)
+	if s.limits.OutputKB == 0 && config.OutputLimit > 0 {
+		limits.OutputLimit = config.OutputLimit
+	}
+	return rce.Job{
+		Program:         code,
+		Language:        s.language,
+		Limits:          limits,
+		Resources:       resources,
+		Tests:           testCases(s.inputs, s.expectedOutputs),
+		Checker:         s.checker,
+		Function:        s.function,
+		Interactor:      s.interactor,
+		Flags:           s.flags,
+		RequireLeakFree: s.requireLeakFree,
+	}
+}
+
+// testCases returns a test case per input with its expected output, if any, run under the limits of the job.
+func testCases(inputs []string, expectedOutputs []string) []rce.TestCase {
+	tests := make([]rce.TestCase, 0, len(inputs))
+	for i, input := range inputs {
+		test := rce.TestCase{Input: rce.StringInput(input)}
+		if i < len(expectedOutputs) {
+			test.Expected = expectedOutputs[i]
+		}
+		tests = append(tests, test)
+	}
+	return tests
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"kiit-lab-engine/core/rce"
+	"kiit-lab-engine/db"
+	"kiit-lab-engine/repository"
+)
+
+type QuestionService interface {
+	GetQuestion(ctx context.Context, id string) (*QuestionView, error)
+	CreateQuestion(ctx context.Context, input CreateQuestionInput) (*db.QuestionModel, error)
+}
+
+type questionService struct {
+	questionRepo repository.QuestionRepository
+}
+
+func NewQuestionService(questionRepo repository.QuestionRepository) QuestionService {
+	return &questionService{
+		questionRepo: questionRepo,
+	}
+}
+
+type CreateQuestionInput struct {
+	AssignmentID     string
+	Question         string
+	TotalMarks       int
+	AllowedLanguages []string       // Languages submissions may be written in, identifiers from the rce language registry
+	FunctionName     string         // Function submissions define, called through a harness; submissions run as is when empty
+	Parameters       []rce.Variable // Parameters of the function, in order
+	ReturnType       rce.ValueType  // Void when empty
+	TestCases        []string
+	ExpectedOutputs  []string            // One per test case
+	SampleTests      int                 // Number of test cases, from the first, shown to students; the rest are hidden
+	Checker          *rce.CheckerSpec    // Compares the outputs with the expected outputs, exact comparison when nil
+	Interactor       *rce.InteractorSpec // Talks to submissions and judges them, instead of a checker
+	Flags            *rce.CompilerFlags  // Submissions are built with them, every allowed language must accept them
+	Limits           rce.QuestionLimits  // Resource limits of submissions, zero fields keep the defaults of their language
+	RequireLeakFree  bool                // Submissions in languages supporting memcheck run under it and leaking ones are not accepted
+}
+
+// QuestionView is what students see of a question: its statement and sample tests, not its hidden tests or how it judges code.
+type QuestionView struct {
+	ID               string            `json:"id"`
+	Question         string            `json:"question"`
+	TotalMarks       int               `json:"totalMarks"`
+	AllowedLanguages []string          `json:"allowedLanguages"`
+	Function         *rce.FunctionSpec `json:"function,omitempty"` // Signature of the function submissions define, nil when they run as is
+	SampleTests      []SampleTest      `json:"sampleTests"`
+}
+
+// SampleTest is a test case of a question shown to students.
+type SampleTest struct {
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"`
+}
+
+// GetQuestion returns what students see of the question.
+func (q *questionService) GetQuestion(ctx context.Context, id string) (*QuestionView, error) {
+	question, err := q.questionRepo.GetQuestionFromId(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &QuestionView{
+		ID:               question.ID,
+		Question:         question.Que,
+		TotalMarks:       question.TotalMarks,
+		AllowedLanguages: question.AllowedLanguage,
+		SampleTests:      []SampleTest{},
+	}
+	if question.FunctionName != "" {
+		view.Function = questionFunction(question)
+	}
+
+	for i := 0; i < sampleCount(question); i++ {
+		view.SampleTests = append(view.SampleTests, SampleTest{Input: question.TestCases[i], ExpectedOutput: question.ExpectedOutputs[i]})
+	}
+	return view, nil
+}
+
+// sampleCount returns the number of test cases of the question, from the first, that are samples.
+func sampleCount(question *db.QuestionModel) int {
+	return max(0, min(question.SampleTests, len(question.TestCases), len(question.ExpectedOutputs)))
+}
+
+// CreateQuestion stores the question with its allowed languages checked against the language registry and stored by their identifiers.
+// The function, the checker and the interactor must be usable, every allowed language must accept the compiler flags,
+// the limits must be within the bounds of the engine, every test case needs an expected output and the samples must be test cases.
+func (q *questionService) CreateQuestion(ctx context.Context, input CreateQuestionInput) (*db.QuestionModel, error) {
+	languages, err := parseLanguages(input.AllowedLanguages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(input.ExpectedOutputs) != len(input.TestCases) {
+		return nil, fmt.Errorf("expected %d expected outputs, got %d", len(input.TestCases), len(input.ExpectedOutputs))
+	}
+	if input.SampleTests < 0 || input.SampleTests > len(input.TestCases) {
+		return nil, fmt.Errorf("sample tests must be between 0 and %d", len(input.TestCases))
+	}
+
+	switch {
+	case input.FunctionName != "":
+		function := rce.FunctionSpec{Name: input.FunctionName, Parameters: input.Parameters, ReturnType: input.ReturnType}
+		if err := function.Validate(); err != nil {
+			return nil, err
+		}
+	case len(input.Parameters) > 0 || input.ReturnType != "":
+		return nil, errors.New("parameters and a return type need a function name")
+	}
+
+	if input.Checker != nil && input.Interactor != nil {
+		return nil, errors.New("a question cannot have both a checker and an interactor")
+	}
+
+	var checker, interactor []byte
+	if input.Checker != nil {
+		if err := input.Checker.Validate(); err != nil {
+			return nil, err
+		}
+		if checker, err = json.Marshal(input.Checker); err != nil {
+			return nil, err
+		}
+	}
+	if input.Interactor != nil {
+		if err := input.Interactor.Validate(); err != nil {
+			return nil, err
+		}
+		if interactor, err = json.Marshal(input.Interactor); err != nil {
+			return nil, err
+		}
+	}
+
+	var flags []byte
+	if input.Flags != nil {
+		for _, language := range languages {
+			if err := input.Flags.Validate(rce.Language(language)); err != nil {
+				return nil, err
+			}
+		}
+		if flags, err = json.Marshal(input.Flags); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := input.Limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	variables := make([]repository.NewInputVariable, 0, len(input.Parameters))
+	for _, parameter := range input.Parameters {
+		variables = append(variables, repository.NewInputVariable{Name: parameter.Name, Type: string(parameter.Type)})
+	}
+
+	return q.questionRepo.CreateQuestion(ctx, repository.NewQuestionInput{
+		AssignmentID:     input.AssignmentID,
+		Que:              input.Question,
+		TotalMarks:       input.TotalMarks,
+		AllowedLanguages: languages,
+		FunctionName:     input.FunctionName,
+		InputVariables:   variables,
+		ReturnType:       string(input.ReturnType),
+		TestCases:        input.TestCases,
+		ExpectedOutputs:  input.ExpectedOutputs,
+		SampleTests:      input.SampleTests,
+		Checker:          checker,
+		Interactor:       interactor,
+		Flags:            flags,
+		TimeLimitMs:      int(input.Limits.TimeMs),
+		MemoryLimitMb:    int(input.Limits.MemoryMB),
+		ProcessLimit:     int(input.Limits.Processes),
+		OutputLimitKb:    int(input.Limits.OutputKB),
+		CPUShare:         input.Limits.CPUShare,
+		RequireLeakFree:  input.RequireLeakFree,
+	})
+}
+
+// parseLanguages returns the registry identifiers of the languages, without duplicates. At least one language is required.
+func parseLanguages(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, errors.New("a question must allow at least one language")
+	}
+
+	languages := make([]string, 0, len(names))
+	for _, name := range names {
+		language, err := rce.ParseLanguage(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(languages, string(language)) {
+			languages = append(languages, string(language))
+		}
+	}
+	return languages, nil
+}
+
+// questionLanguage returns the registered language with the given identifier, when the question allows submissions in it.
+func questionLanguage(question *db.QuestionModel, name string) (rce.Language, error) {
+	language, err := rce.ParseLanguage(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, allowed := range question.AllowedLanguage {
+		// Languages stored before they were validated may not be in the registry
+		parsed, err := rce.ParseLanguage(allowed)
+		if err != nil {
+			log.Printf("Failed to parse allowed language of question %s: %v", question.ID, err)
+			continue
+		}
+		if parsed == language {
+			return language, nil
+		}
+	}
+	return "", fmt.Errorf("language %s is not allowed for this question", language)
+}
+
+// judgeSettings is how a question judges the code submitted to it, read from the question.
+type judgeSettings struct {
+	language        rce.Language
+	inputs          []string            // Test cases of the question
+	expectedOutputs []string            // One per input
+	samples         int                 // Number of test cases, from the first, that are samples
+	checker         *rce.CheckerSpec    // Exact comparison when the question sets none, nil with an interactor
+	function        *rce.FunctionSpec   // nil runs the code as is
+	interactor      *rce.InteractorSpec // Judges the code instead of the checker
+	flags           *rce.CompilerFlags  // nil builds with the compile command of the language
+	limits          rce.QuestionLimits  // Zero fields keep the defaults of the language
+	requireLeakFree bool                // Runs under memcheck and leaking runs are not accepted, only for languages supporting memcheck
+}
+
+// newJudgeSettings reads how the question judges code in the language, which it must allow.
+// A language the question does not allow is an ErrInvalidSubmission.
+func newJudgeSettings(question *db.QuestionModel, language string) (judgeSettings, error) {
+	parsed, err := questionLanguage(question, language)
+	if err != nil {
+		return judgeSettings{}, fmt.Errorf("%w: %w", ErrInvalidSubmission, err)
+	}
+
+	settings := judgeSettings{
+		language:        parsed,
+		inputs:          question.TestCases,
+		expectedOutputs: question.ExpectedOutputs,
+		samples:         sampleCount(question),
+		requireLeakFree: question.RequireLeakFree && rce.SupportsMemcheck(parsed),
+	}
+	if len(settings.expectedOutputs) != len(settings.inputs) {
+		return judgeSettings{}, fmt.Errorf("question has %d test cases but %d expected outputs", len(settings.inputs), len(settings.expectedOutputs))
+	}
+
+	if raw, ok := question.Checker(); ok {
+		settings.checker = &rce.CheckerSpec{}
+		if err := json.Unmarshal(raw, settings.checker); err != nil {
+			return judgeSettings{}, fmt.Errorf("invalid checker: %w", err)
+		}
+		if err := settings.checker.Validate(); err != nil {
+			return judgeSettings{}, err
+		}
+	}
+
+	if raw, ok := question.Interactor(); ok {
+		settings.interactor = &rce.InteractorSpec{}
+		if err := json.Unmarshal(raw, settings.interactor); err != nil {
+			return judgeSettings{}, fmt.Errorf("invalid interactor: %w", err)
+		}
+		if err := settings.interactor.Validate(); err != nil {
+			return judgeSettings{}, err
+		}
+	}
+	if settings.checker != nil && settings.interactor != nil {
+		return judgeSettings{}, errors.New("question has both a checker and an interactor")
+	}
+	if settings.checker == nil && settings.interactor == nil {
+		settings.checker = &rce.CheckerSpec{Kind: rce.CheckerExact}
+	}
+
+	// Flags stored before they were validated, or since disallowed for the language, are not trusted
+	if raw, ok := question.CompilerFlags(); ok {
+		settings.flags = &rce.CompilerFlags{}
+		if err := json.Unmarshal(raw, settings.flags); err != nil {
+			return judgeSettings{}, fmt.Errorf("invalid compiler flags: %w", err)
+		}
+		if err := settings.flags.Validate(settings.language); err != nil {
+			return judgeSettings{}, err
+		}
+	}
+
+	settings.limits = questionLimits(question)
+	if err := settings.limits.Validate(); err != nil {
+		return judgeSettings{}, err
+	}
+
+	if question.FunctionName != "" {
+		settings.function = questionFunction(question)
+		if err := settings.function.Validate(); err != nil {
+			return judgeSettings{}, err
+		}
+	}
+
+	return settings, nil
+}
+
+// questionFunction returns the function the question asks for, with its parameters in order.
+func questionFunction(question *db.QuestionModel) *rce.FunctionSpec {
+	function := &rce.FunctionSpec{Name: question.FunctionName}
+	if returnType, ok := question.ReturnType(); ok {
+		function.ReturnType = rce.ValueType(returnType)
+	}
+
+	for _, variable := range question.InputVariables() {
+		parameter := rce.Variable{Name: variable.Name}
+		if valueType, ok := variable.Type(); ok {
+			parameter.Type = rce.ValueType(valueType)
+		}
+		function.Parameters = append(function.Parameters, parameter)
+	}
+	return function
+}
+
+// questionLimits returns the resource limits the question sets, zero for the ones it leaves to the language.
+func questionLimits(question *db.QuestionModel) rce.QuestionLimits {
+	var limits rce.QuestionLimits
+	if timeMs, ok := question.TimeLimitMs(); ok {
+		limits.TimeMs = int64(timeMs)
+	}
+	if memoryMB, ok := question.MemoryLimitMb(); ok {
+		limits.MemoryMB = int64(memoryMB)
+	}
+	if processes, ok := question.ProcessLimit(); ok {
+		limits.Processes = int64(processes)
+	}
+	if outputKB, ok := question.OutputLimitKb(); ok {
+		limits.OutputKB = int64(outputKB)
+	}
+	if cpuShare, ok := question.CPUShare(); ok {
+		limits.CPUShare = cpuShare
+	}
+	return limits
+}